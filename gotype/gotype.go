@@ -27,7 +27,10 @@ func expandErrors(err error) []error {
 	return result
 }
 
-func filenameToImportPath(filename string, bctx *build.Context) (string, error) {
+// FilenameToImportPath returns the import path of the directory filename,
+// or of the directory containing it if filename is not an existing
+// directory. Neither filename nor its directory need exist.
+func FilenameToImportPath(filename string, bctx *build.Context) (string, error) {
 	gopaths := filepath.SplitList(bctx.GOPATH) // list will be empty with no GOPATH
 	for _, gopath := range gopaths {
 		if !filepath.IsAbs(gopath) {
@@ -56,76 +59,198 @@ func filenameToImportPath(filename string, bctx *build.Context) (string, error)
 	return importPath, nil
 }
 
+// Package is a type-checked package along with the syntax trees and type
+// information needed to answer questions about the code in it.
+type Package struct {
+	Fset  *token.FileSet
+	Files []*ast.File // the package's files, parsed with comments
+	Types *types.Package
+	Info  *types.Info
+
+	// Importer is the importer used to load the package's dependencies. It
+	// retains the syntax trees of every package it imported.
+	Importer *Importer
+
+	// Errs holds every error encountered while loading, parsing and
+	// type-checking the package.
+	Errs []error
+}
+
+// File returns the syntax tree of the file containing pos. Both the
+// package's own files and the files of its dependencies are searched.
+func (p *Package) File(pos token.Pos) *ast.File {
+	tf := p.Fset.File(pos)
+	if tf == nil {
+		return nil
+	}
+	for _, f := range p.Files {
+		if p.Fset.File(f.Pos()) == tf {
+			return f
+		}
+	}
+	if p.Importer == nil {
+		return nil
+	}
+	for _, files := range p.Importer.files {
+		for _, f := range files {
+			if p.Fset.File(f.Pos()) == tf {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// FileByName returns the syntax tree of the package's file with the given
+// absolute filename, or nil if it is not part of the package.
+func (p *Package) FileByName(filename string) *ast.File {
+	for _, f := range p.Files {
+		if p.Fset.File(f.Pos()).Name() == filename {
+			return f
+		}
+	}
+	return nil
+}
+
 // Check a file. Context is used for cancellation, build context is used for
 // all the filesystem related operations.
 func CheckFile(ctx context.Context, origFilename string, bctx *build.Context) []error {
-	fset := token.NewFileSet()
-	importPath, err := filenameToImportPath(origFilename, bctx)
+	return Check(ctx, origFilename, bctx).Errs
+}
+
+// Check type-checks the package containing origFilename and records type
+// information for all of its identifiers and expressions. If the package
+// could not be type-checked, the returned Package has a nil Types field and
+// Errs says why.
+func Check(ctx context.Context, origFilename string, bctx *build.Context) *Package {
+	importPath, err := FilenameToImportPath(origFilename, bctx)
 	if err != nil {
-		return []error{err}
+		return failed(err)
 	}
 
-	var retErrs []error
+	// Get the file we want.
+	bp, err := bctx.Import(importPath, "", 0)
+	if err != nil {
+		log.Println("Error reading package", err)
+		return failed(err)
+	}
+
+	var relativePaths []string
+	switch base := filepath.Base(origFilename); {
+	case contains(bp.XTestGoFiles, base):
+		// External test files form their own package which imports
+		// the package under test.
+		relativePaths = append(relativePaths, bp.XTestGoFiles...)
+		importPath += "_test"
+	case strings.HasSuffix(origFilename, "_test.go"):
+		relativePaths = append(relativePaths, bp.GoFiles...)
+		relativePaths = append(relativePaths, bp.TestGoFiles...)
+	default:
+		relativePaths = append(relativePaths, bp.GoFiles...)
+	}
+	return CheckFiles(ctx, bctx, importPath, bp.Dir, relativePaths)
+}
+
+// CheckFiles type-checks the named files in dir as the package with the
+// given import path. It is used when the caller needs control over which of
+// a package's files are checked, e.g. to include its tests.
+func CheckFiles(ctx context.Context, bctx *build.Context, importPath, dir string, relativePaths []string) *Package {
+	pkg := newPackage(ctx, bctx)
 
 	// Cgo must be enabled for FakeImportC to work.
 	if bctx.CgoEnabled == false {
 		log.Println("bctx.CgoEnabled = false, failing to typecheck.")
-		return nil
+		return pkg
 	}
 
 	// if checkPkgFiles is called multiple times, set up conf only once
 	typeConf := types.Config{
 		FakeImportC: true,
 		Error: func(err error) {
-			retErrs = append(retErrs, expandErrors(err)...)
+			pkg.Errs = append(pkg.Errs, expandErrors(err)...)
 		},
 
 		// Changed because I want to use the srcimporter with go 1.8
-		Importer: New(ctx, bctx, fset, make(map[string]*types.Package)),
+		Importer: pkg.Importer,
 		// In Go 1.9, we can just do something like this.
 		//Importer: importer.Lookup("source", "")
 		// Changed to work with go 1.8
-		Sizes: &types.StdSizes{8, 8},
+		Sizes: &types.StdSizes{WordSize: 8, MaxAlign: 8},
 	}
 
-	// Get the file we want.
-	bp, err := bctx.Import(importPath, "", 0)
-	if err != nil {
-		log.Println("Error reading package", err)
-		return []error{err}
-	}
-
-	testPackage := strings.HasSuffix(origFilename, "_test.go")
-	var relativePaths []string
-	relativePaths = append(relativePaths, bp.GoFiles...)
-	if testPackage {
-		relativePaths = append(relativePaths, bp.TestGoFiles...)
-	}
-	parsedFiles := make([]*ast.File, len(relativePaths))
+	files := make([]*ast.File, len(relativePaths))
+	var parseErrs []error
 	for i, relativePath := range relativePaths {
 		// Parsing is an expensive operation, check if the context has expired.
 		if ctx.Err() != nil {
-			return []error{ctx.Err()}
+			pkg.Errs = []error{ctx.Err()}
+			return pkg
 		}
 
-		absPath := filepath.Join(bp.Dir, relativePath)
+		absPath := filepath.Join(dir, relativePath)
 		src, err := bctx.OpenFile(absPath)
 		if err != nil {
 			log.Println("Error opening file", err)
-			return []error{err}
+			pkg.Errs = []error{err}
+			return pkg
 		}
-		parsedFiles[i], err = parser.ParseFile(fset, absPath, src, 0)
+		files[i], err = parser.ParseFile(pkg.Fset, absPath, src, parser.ParseComments)
 		src.Close()
 		if err != nil {
 			log.Println("Error parsing file", err)
-			return []error{err}
+			parseErrs = append(parseErrs, err)
+			if files[i] == nil {
+				pkg.Errs = parseErrs
+				return pkg
+			}
 		}
 	}
 
+	pkg.Files = files
+
+	// Files with syntax errors are still type-checked as far as they
+	// could be parsed, since the file being edited is usually
+	// incomplete, e.g. right after typing "x.".
 	log.Println("Checking", importPath)
-	_, err = typeConf.Check(importPath, fset, parsedFiles, nil)
+	var err error
+	pkg.Types, err = typeConf.Check(importPath, pkg.Fset, pkg.Files, pkg.Info)
 	if err != nil {
-		retErrs = append(retErrs, err)
+		pkg.Errs = append(pkg.Errs, err)
+	}
+	if len(parseErrs) > 0 {
+		// Type errors in code that does not parse are mostly noise.
+		pkg.Errs = parseErrs
+	}
+	return pkg
+}
+
+// newPackage returns an empty Package ready to be type-checked.
+func newPackage(ctx context.Context, bctx *build.Context) *Package {
+	fset := token.NewFileSet()
+	return &Package{
+		Fset: fset,
+		Info: &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Implicits:  make(map[ast.Node]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+			Scopes:     make(map[ast.Node]*types.Scope),
+		},
+		Importer: New(ctx, bctx, fset, make(map[string]*types.Package)),
+	}
+}
+
+// failed returns a Package that could not be type-checked because of err.
+func failed(err error) *Package {
+	return &Package{Fset: token.NewFileSet(), Errs: []error{err}}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
 	}
-	return retErrs
+	return false
 }
@@ -24,6 +24,8 @@ type Importer struct {
 	fset     *token.FileSet
 	sizes    types.Sizes
 	packages map[string]*types.Package
+	files    map[string][]*ast.File // syntax trees of imported packages, by import path
+	broken   map[string]error       // packages that were imported despite type errors
 
 	ctx context.Context
 }
@@ -39,8 +41,10 @@ func New(ctx context.Context, ctxt *build.Context, fset *token.FileSet, packages
 		ctxt: ctxt,
 		fset: fset,
 		// Changed to work in go 1.8.
-		sizes:    &types.StdSizes{8, 8},
+		sizes:    &types.StdSizes{WordSize: 8, MaxAlign: 8},
 		packages: packages,
+		files:    make(map[string][]*ast.File),
+		broken:   make(map[string]error),
 		ctx:      ctx,
 	}
 }
@@ -110,7 +114,7 @@ func (p *Importer) ImportFrom(path, srcDir string, mode types.ImportMode) (*type
 			// Return incomplete package with error (see #16088).
 			return pkg, fmt.Errorf("reimported partially imported package %q", bp.ImportPath)
 		}
-		return pkg, nil
+		return pkg, p.broken[origImportPath]
 	}
 
 	p.packages[origImportPath] = &importing
@@ -138,6 +142,7 @@ func (p *Importer) ImportFrom(path, srcDir string, mode types.ImportMode) (*type
 	if err != nil {
 		return nil, err
 	}
+	p.files[bp.ImportPath] = files
 
 	// type-check package files
 	var firstHardErr error
@@ -155,14 +160,18 @@ func (p *Importer) ImportFrom(path, srcDir string, mode types.ImportMode) (*type
 	}
 	pkg, err = conf.Check(bp.ImportPath, p.fset, files, nil)
 	if err != nil {
-		// If there was a hard error it is possibly unsafe
-		// to use the package as it may not be fully populated.
-		// Do not return it (see also #20837, #20855).
+		// Upstream drops packages with hard errors since they may not be
+		// fully populated (see also #20837, #20855). Those go/types
+		// crashes are long fixed, and the declarations that did check
+		// keep their positions, which lets us resolve symbols in a
+		// dependency that is in the middle of being edited.
 		if firstHardErr != nil {
-			pkg = nil
 			err = firstHardErr // give preference to first hard error over any soft error
 		}
-		return pkg, fmt.Errorf("type-checking package %q failed (%v)", bp.ImportPath, err)
+		err = fmt.Errorf("type-checking package %q failed (%v)", bp.ImportPath, err)
+		p.packages[origImportPath] = pkg
+		p.broken[origImportPath] = err
+		return pkg, err
 	}
 	if firstHardErr != nil {
 		// this can only happen if we have a bug in go/types
@@ -173,6 +182,12 @@ func (p *Importer) ImportFrom(path, srcDir string, mode types.ImportMode) (*type
 	return pkg, nil
 }
 
+// Files returns the syntax trees of the package with the given import path,
+// or nil if the importer has not loaded it.
+func (p *Importer) Files(path string) []*ast.File {
+	return p.files[path]
+}
+
 func (p *Importer) parseFiles(dir string, filenames []string) ([]*ast.File, error) {
 	open := p.ctxt.OpenFile // possibly nil
 
@@ -190,7 +205,7 @@ func (p *Importer) parseFiles(dir string, filenames []string) ([]*ast.File, erro
 					errors[i] = fmt.Errorf("opening package file %s failed (%v)", filepath, err)
 					return
 				}
-				files[i], errors[i] = parser.ParseFile(p.fset, filepath, src, 0)
+				files[i], errors[i] = parser.ParseFile(p.fset, filepath, src, parser.ParseComments)
 				src.Close() // ignore Close error - parsing may have succeeded which is all we need
 			} else {
 				// Special-case when ctxt doesn't provide a custom OpenFile and use the
@@ -198,7 +213,7 @@ func (p *Importer) parseFiles(dir string, filenames []string) ([]*ast.File, erro
 				// bit faster than opening the file and providing an io.ReaderCloser in
 				// both cases.
 				// TODO(gri) investigate performance difference (issue #19281)
-				files[i], errors[i] = parser.ParseFile(p.fset, filepath, nil, 0)
+				files[i], errors[i] = parser.ParseFile(p.fset, filepath, nil, parser.ParseComments)
 			}
 		}(i, p.joinPath(dir, filename))
 	}
@@ -2,8 +2,13 @@ package langserver
 
 import (
 	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
 
+	"github.com/adamfaulkner/go-langserver/gotype"
 	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/ast/astutil"
 )
 
 func offsetForPosition(contents []byte, p lsp.Position) (offset int, valid bool, whyInvalid string) {
@@ -27,8 +32,127 @@ func offsetForPosition(contents []byte, p lsp.Position) (offset int, valid bool,
 			col++
 		}
 	}
+	if line == p.Line && col == p.Character {
+		// The end of the file.
+		return offset, true, ""
+	}
 	if line == 0 {
 		return 0, false, fmt.Sprintf("character %d is beyond first line boundary", p.Character)
 	}
 	return 0, false, fmt.Sprintf("file only has %d lines", line+1)
 }
+
+// posForPosition converts an LSP position in the file tf to a token.Pos.
+// The start of the line after the last one is the end of the file, like
+// the end of a full-document range.
+func posForPosition(tf *token.File, p lsp.Position) (token.Pos, error) {
+	if p.Line == tf.LineCount() && p.Character == 0 {
+		return tf.Pos(tf.Size()), nil
+	}
+	if p.Line < 0 || p.Line >= tf.LineCount() {
+		return token.NoPos, fmt.Errorf("line %d is beyond the end of %s (%d lines)", p.Line, tf.Name(), tf.LineCount())
+	}
+	offset := tf.Offset(tf.LineStart(p.Line+1)) + p.Character
+	if p.Character < 0 || offset > tf.Size() {
+		return token.NoPos, fmt.Errorf("character %d is beyond line %d boundary", p.Character, p.Line)
+	}
+	return tf.Pos(offset), nil
+}
+
+// positionForPos converts pos to an LSP position. Like the rest of the
+// server, it counts bytes rather than characters.
+func positionForPos(fset *token.FileSet, pos token.Pos) lsp.Position {
+	p := fset.PositionFor(pos, false)
+	return lsp.Position{Line: p.Line - 1, Character: p.Column - 1}
+}
+
+// rangeForNode returns the LSP range spanning n.
+func rangeForNode(fset *token.FileSet, n ast.Node) lsp.Range {
+	return rangeForPos(fset, n.Pos(), n.End())
+}
+
+// rangeForPos returns the LSP range spanning [start, end).
+func rangeForPos(fset *token.FileSet, start, end token.Pos) lsp.Range {
+	return lsp.Range{Start: positionForPos(fset, start), End: positionForPos(fset, end)}
+}
+
+// locationForNode returns the LSP location of n.
+func locationForNode(fset *token.FileSet, n ast.Node) lsp.Location {
+	return locationForPos(fset, n.Pos(), n.End())
+}
+
+// locationForPos returns the LSP location of [start, end).
+func locationForPos(fset *token.FileSet, start, end token.Pos) lsp.Location {
+	return lsp.Location{
+		URI:   pathToURI(fset.PositionFor(start, false).Filename),
+		Range: rangeForPos(fset, start, end),
+	}
+}
+
+// pathEnclosingPosition returns the path of nodes enclosing the LSP position
+// p in f, innermost first, along with p converted to a token.Pos.
+func pathEnclosingPosition(fset *token.FileSet, f *ast.File, p lsp.Position) ([]ast.Node, token.Pos, error) {
+	pos, err := posForPosition(fset.File(f.Pos()), p)
+	if err != nil {
+		return nil, token.NoPos, err
+	}
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	return path, pos, nil
+}
+
+// objectAtPosition returns the identifier (or import path, for import
+// specs without a name) at p in f along with the object it denotes. A nil
+// node is returned if there is nothing at p that refers to an object.
+func objectAtPosition(pkg *gotype.Package, f *ast.File, p lsp.Position) (ast.Node, types.Object, error) {
+	path, pos, err := pathEnclosingPosition(pkg.Fset, f, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Editors commonly report the position just after an identifier, so
+	// fall back to the preceding byte.
+	if _, ok := path[0].(*ast.Ident); !ok && pos > f.Pos() {
+		if prev, _ := astutil.PathEnclosingInterval(f, pos-1, pos-1); len(prev) > 0 {
+			if _, ok := prev[0].(*ast.Ident); ok {
+				path = prev
+			}
+		}
+	}
+
+	switch n := path[0].(type) {
+	case *ast.Ident:
+		if obj := pkg.Info.ObjectOf(n); obj != nil {
+			return n, obj, nil
+		}
+		// The identifier of a type switch guard has no object of
+		// its own; each clause gets an implicit one.
+		for _, n2 := range path[1:] {
+			if sw, ok := n2.(*ast.TypeSwitchStmt); ok {
+				for _, clause := range sw.Body.List {
+					if obj := pkg.Info.Implicits[clause]; obj != nil && obj.Name() == n.Name {
+						return n, obj, nil
+					}
+				}
+				break
+			}
+		}
+	case *ast.BasicLit:
+		if spec, ok := path[1].(*ast.ImportSpec); ok {
+			if obj := importedPkgName(pkg.Info, spec); obj != nil {
+				return n, obj, nil
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// importedPkgName returns the package name object declared by spec.
+func importedPkgName(info *types.Info, spec *ast.ImportSpec) *types.PkgName {
+	var obj types.Object
+	if spec.Name != nil {
+		obj = info.Defs[spec.Name]
+	} else {
+		obj = info.Implicits[spec]
+	}
+	pkgName, _ := obj.(*types.PkgName)
+	return pkgName
+}
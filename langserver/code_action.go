@@ -0,0 +1,135 @@
+package langserver
+
+import (
+	"context"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// codeActionKinds are the kinds of code actions the server provides.
+var codeActionKinds = []lsp.CodeActionKind{
+	lsp.CAKQuickFix,
+	lsp.CAKRefactorExtract,
+	lsp.CAKRefactorInline,
+	lsp.CAKRefactorRewrite,
+	lsp.CAKSourceOrganizeImports,
+}
+
+// handleCodeAction returns the code actions available for the range of the
+// request. Clients that do not support CodeAction literals get none, since
+// every action is a workspace edit rather than a command.
+func (h *LangHandler) handleCodeAction(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.CodeActionParams) ([]lsp.CodeAction, error) {
+	actions := []lsp.CodeAction{}
+	if h.init.Capabilities.TextDocument.CodeAction.CodeActionLiteralSupport == nil {
+		return actions, nil
+	}
+	uri := params.TextDocument.URI
+	pkg, f, err := h.typecheck(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := h.readFile(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	bctx := h.checkBuildContext(ctx)
+
+	if wantCodeAction(params.Context.Only, lsp.CAKQuickFix) && len(params.Context.Diagnostics) > 0 {
+		actions = append(actions, quickFixes(ctx, bctx, h.packages, pkg, f, contents, params.Context.Diagnostics)...)
+	}
+	// The other actions apply to the range, and are left out if it is
+	// not in the file.
+	if start, end, err := selection(pkg, f, contents, params.Range); err == nil {
+		actions = append(actions, rangeActions(bctx, pkg, f, contents, uri, start, end, params.Context.Only, params.Context.Diagnostics)...)
+	}
+	if wantCodeAction(params.Context.Only, lsp.CAKSourceOrganizeImports) {
+		// Imports cannot be organized in a file with syntax errors,
+		// which should not keep the other actions from the client.
+		edits, err := organizeImports(ctx, bctx, h.packages, h.options.LocalImportPrefix, pkg, f, contents)
+		if err == nil && len(edits) > 0 {
+			actions = append(actions, lsp.CodeAction{
+				Title: "Organize imports",
+				Kind:  lsp.CAKSourceOrganizeImports,
+				Edit:  fileEdit(uri, edits),
+			})
+		}
+	}
+	return actions, nil
+}
+
+// rangeActions returns the refactorings of the range from start to end of
+// f, whose source is contents, and the actions implementing an interface
+// there.
+func rangeActions(bctx *build.Context, pkg *gotype.Package, f *ast.File, contents []byte, uri lsp.DocumentURI, start, end token.Pos, only []lsp.CodeActionKind, diags []lsp.Diagnostic) []lsp.CodeAction {
+	var actions []lsp.CodeAction
+	if wantCodeAction(only, lsp.CAKRefactorExtract) && start != end {
+		// The selection is often neither an expression nor a list of
+		// statements, so the actions that do not apply are left out.
+		if edits, err := extractVariable(pkg, f, contents, start, end); err == nil {
+			actions = append(actions, lsp.CodeAction{
+				Title: "Extract variable",
+				Kind:  lsp.CAKRefactorExtract,
+				Edit:  fileEdit(uri, edits),
+			})
+		}
+		if edits, err := extractFunction(pkg, f, contents, start, end); err == nil {
+			actions = append(actions, lsp.CodeAction{
+				Title: "Extract function",
+				Kind:  lsp.CAKRefactorExtract,
+				Edit:  fileEdit(uri, edits),
+			})
+		}
+	}
+	if wantCodeAction(only, lsp.CAKRefactorInline) {
+		if edits, err := inlineVariable(pkg, f, contents, start); err == nil {
+			actions = append(actions, lsp.CodeAction{
+				Title: "Inline variable",
+				Kind:  lsp.CAKRefactorInline,
+				Edit:  fileEdit(uri, edits),
+			})
+		}
+		if edits, err := inlineCall(bctx, pkg, f, contents, start); err == nil {
+			actions = append(actions, lsp.CodeAction{
+				Title: "Inline call",
+				Kind:  lsp.CAKRefactorInline,
+				Edit:  fileEdit(uri, edits),
+			})
+		}
+	}
+	if wantCodeAction(only, lsp.CAKRefactorRewrite) {
+		if edits, err := fillStruct(pkg, f, contents, start); err == nil {
+			actions = append(actions, lsp.CodeAction{
+				Title: "Fill struct literal",
+				Kind:  lsp.CAKRefactorRewrite,
+				Edit:  fileEdit(uri, edits),
+			})
+		}
+	}
+	return append(actions, implementActions(pkg, f, start, only, diags)...)
+}
+
+// wantCodeAction reports whether a client asking for the kinds only wants
+// code actions of the given kind. A kind includes its subkinds, and no
+// kinds means any.
+func wantCodeAction(only []lsp.CodeActionKind, kind lsp.CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, o := range only {
+		if kind == o || strings.HasPrefix(string(kind), string(o)+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// fileEdit returns a workspace edit applying edits to the file uri.
+func fileEdit(uri lsp.DocumentURI, edits []lsp.TextEdit) *lsp.WorkspaceEdit {
+	return &lsp.WorkspaceEdit{Changes: map[string][]lsp.TextEdit{string(uri): edits}}
+}
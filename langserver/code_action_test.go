@@ -0,0 +1,116 @@
+package langserver
+
+import (
+	"context"
+	"go/token"
+	"reflect"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+func TestCodeActionsRangeAtEOF(t *testing.T) {
+	var params InitializeParams
+	params.Capabilities.TextDocument.CodeAction.CodeActionLiteralSupport = &lsp.CodeActionLiteralSupport{}
+	h, _ := initializeTestHandler(t, params)
+	const src = "package a\n\nimport \"os\"\n\nfunc F() {}\n"
+	const uri = "file:///gopath/src/a/a.go"
+	h.overlay.set(uri, []byte(src))
+
+	// The range of the whole document, as clients send it for source
+	// actions on save, ends at the start of the line after the last.
+	full := lsp.Range{End: lsp.Position{Line: 5}}
+	tests := []struct {
+		only []lsp.CodeActionKind
+		want []string
+	}{
+		{[]lsp.CodeActionKind{lsp.CAKSourceOrganizeImports}, []string{"Organize imports"}},
+		{[]lsp.CodeActionKind{lsp.CAKRefactor}, nil},
+		{nil, []string{"Organize imports"}},
+	}
+	for _, test := range tests {
+		actions, err := h.handleCodeAction(context.Background(), nil, nil, lsp.CodeActionParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+			Range:        full,
+			Context:      lsp.CodeActionContext{Only: test.only},
+		})
+		if err != nil {
+			t.Fatalf("%v: %v", test.only, err)
+		}
+		var got []string
+		for _, action := range actions {
+			got = append(got, action.Title)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got actions %q, want %q", test.only, got, test.want)
+		}
+	}
+
+	// A range beyond the end of the file leaves out the refactorings only.
+	actions, err := h.handleCodeAction(context.Background(), nil, nil, lsp.CodeActionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Range:        lsp.Range{End: lsp.Position{Line: 9}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || actions[0].Title != "Organize imports" {
+		t.Errorf("got actions %+v beyond the end of the file, want Organize imports", actions)
+	}
+}
+
+func TestPosForPosition(t *testing.T) {
+	fset := token.NewFileSet()
+	const src = "package a\n\nfunc F() {}\n"
+	tf := fset.AddFile("/a.go", -1, len(src))
+	tf.SetLinesForContent([]byte(src))
+	tests := []struct {
+		p    lsp.Position
+		want int // offset, or -1 for an error
+	}{
+		{lsp.Position{Line: 2, Character: 5}, 16},
+		// The end of a full-document range.
+		{lsp.Position{Line: 3}, len(src)},
+		{lsp.Position{Line: 3, Character: 1}, -1},
+		{lsp.Position{Line: 4}, -1},
+	}
+	for _, test := range tests {
+		pos, err := posForPosition(tf, test.p)
+		if test.want < 0 {
+			if err == nil {
+				t.Errorf("%v: got offset %d, want an error", test.p, tf.Offset(pos))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.p, err)
+		} else if got := tf.Offset(pos); got != test.want {
+			t.Errorf("%v: got offset %d, want %d", test.p, got, test.want)
+		}
+	}
+}
+
+func TestCodeActionsSyntaxError(t *testing.T) {
+	var params InitializeParams
+	params.Capabilities.TextDocument.CodeAction.CodeActionLiteralSupport = &lsp.CodeActionLiteralSupport{}
+	h, _ := initializeTestHandler(t, params)
+	const src = "package a\n\nfunc F() int {\n\tx := 1 + 2\n\treturn x +\n}\n"
+	const uri = "file:///gopath/src/a/a.go"
+	h.overlay.set(uri, []byte(src))
+
+	// Organizing imports fails, but the refactorings are still offered.
+	actions, err := h.handleCodeAction(context.Background(), nil, nil, lsp.CodeActionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Range:        lsp.Range{Start: lsp.Position{Line: 3, Character: 6}, End: lsp.Position{Line: 3, Character: 11}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, action := range actions {
+		got = append(got, action.Title)
+	}
+	if want := []string{"Extract variable"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got actions %q, want %q", got, want)
+	}
+}
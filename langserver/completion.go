@@ -0,0 +1,670 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+func (h *LangHandler) handleCompletion(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) (*lsp.CompletionList, error) {
+	pkg, f, err := h.typecheck(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return completion(pkg, f, params.Position, completionOptions{
+		ctx:      ctx,
+		bctx:     h.BuildContext(context.Background()),
+		packages: h.packages,
+		snippets: h.init.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport,
+	})
+}
+
+// completionOptions configures completion.
+type completionOptions struct {
+	ctx  context.Context
+	bctx *build.Context
+
+	// packages, if non-nil, is used to complete the members of packages
+	// that are not imported yet.
+	packages *packageIndex
+
+	// snippets enables completions that insert snippets, e.g. a check
+	// of err returning the enclosing function's zero values.
+	snippets bool
+}
+
+// Bonuses added to the fuzzy match score of a completion candidate. A
+// candidate of the expected type beats any difference in how well the names
+// match.
+const (
+	scoreAssignable    = 2000 // the candidate has the expected type
+	scoreCallable      = 1500 // calling the candidate gives the expected type
+	scoreStructField   = 1200 // a field name in a struct literal
+	scoreLocal         = 30   // declared in the enclosing function
+	scorePackageLevel  = 20   // declared in the current package
+	scoreKeywordOffset = -10
+)
+
+// completer holds the state needed to compute the completions at a
+// position in a file.
+type completer struct {
+	pkg  *gotype.Package
+	f    *ast.File
+	pos  token.Pos
+	path []ast.Node // from the innermost node enclosing pos to f
+	qf   types.Qualifier
+	opts completionOptions
+
+	prefix   string     // the part of the identifier being typed before pos
+	rng      lsp.Range  // range replaced by a completion
+	expected types.Type // type expected at pos, or nil if unknown
+
+	candidates []candidate
+	seen       map[string]bool // labels of candidates
+}
+
+// candidate is a completion item along with its rank; higher is better.
+type candidate struct {
+	item  lsp.CompletionItem
+	score int
+}
+
+// completion returns the completions at position p in f, best matches
+// first. Depending on the context these are the fields and methods after a
+// selector, the members of a package, the field names of a struct literal,
+// or the identifiers and keywords in scope. Candidates whose type is
+// assignable to the type expected at p are ranked first.
+func completion(pkg *gotype.Package, f *ast.File, p lsp.Position, opts completionOptions) (*lsp.CompletionList, error) {
+	c, err := newCompleter(pkg, f, p, opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &lsp.CompletionList{Items: []lsp.CompletionItem{}}
+	if c == nil {
+		return list, nil
+	}
+
+	if sel, ok := c.selector(); ok {
+		c.selectorCandidates(sel)
+		c.unimportedCandidates(sel)
+	} else {
+		if lit, ok := c.structLiteralKey(); ok {
+			c.structFieldCandidates(lit)
+		}
+		c.scopeCandidates()
+		c.keywordCandidates()
+		c.snippetCandidates()
+	}
+
+	sort.SliceStable(c.candidates, func(i, j int) bool {
+		a, b := c.candidates[i], c.candidates[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.item.Label < b.item.Label
+	})
+	for i, cand := range c.candidates {
+		item := cand.item
+		item.SortText = fmt.Sprintf("%05d", i)
+		list.Items = append(list.Items, item)
+	}
+	return list, nil
+}
+
+// newCompleter returns a completer for position p in f, or nil if nothing
+// should be completed there, e.g. inside a comment or string literal.
+func newCompleter(pkg *gotype.Package, f *ast.File, p lsp.Position, opts completionOptions) (*completer, error) {
+	path, pos, err := pathEnclosingPosition(pkg.Fset, f, p)
+	if err != nil {
+		return nil, err
+	}
+	for _, cg := range f.Comments {
+		if cg.Pos() <= pos && pos <= cg.End() {
+			return nil, nil
+		}
+	}
+	if lit, ok := path[0].(*ast.BasicLit); ok && lit.Kind != token.INT && lit.Kind != token.FLOAT {
+		return nil, nil
+	}
+
+	c := &completer{
+		pkg:  pkg,
+		f:    f,
+		pos:  pos,
+		path: path,
+		qf:   qualifier(pkg.Types),
+		opts: opts,
+		rng:  rangeForPos(pkg.Fset, pos, pos),
+		seen: make(map[string]bool),
+	}
+	// The identifier being typed ends at pos, so it may not enclose it.
+	if _, ok := path[0].(*ast.Ident); !ok && pos > f.Pos() {
+		if prev, _ := astutil.PathEnclosingInterval(f, pos-1, pos-1); len(prev) > 0 {
+			if _, ok := prev[0].(*ast.Ident); ok {
+				c.path = prev
+			}
+		}
+	}
+	if ident, ok := c.path[0].(*ast.Ident); ok && ident.Pos() <= pos && pos <= ident.End() {
+		c.prefix = ident.Name[:pos-ident.Pos()]
+		c.rng = rangeForPos(pkg.Fset, ident.Pos(), pos)
+	}
+	c.expected = c.expectedType()
+	return c, nil
+}
+
+// selector returns the selector expression whose selected name is being
+// typed at pos, if any. The parser turns a missing name (as in "x.") into
+// an identifier "_" positioned at the following token.
+func (c *completer) selector() (*ast.SelectorExpr, bool) {
+	for _, n := range c.path {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if c.pos > n.X.End() {
+				return n, true
+			}
+			return nil, false
+		case *ast.Ident:
+			continue
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func (c *completer) selectorCandidates(sel *ast.SelectorExpr) {
+	if ident, ok := sel.X.(*ast.Ident); ok {
+		if pkgName, ok := c.pkg.Info.Uses[ident].(*types.PkgName); ok {
+			scope := pkgName.Imported().Scope()
+			for _, name := range scope.Names() {
+				if obj := scope.Lookup(name); obj.Exported() {
+					c.addObject(obj, 0)
+				}
+			}
+			return
+		}
+	}
+
+	tv, ok := c.pkg.Info.Types[sel.X]
+	if !ok || tv.Type == nil {
+		return
+	}
+	T := tv.Type
+	if tv.IsType() {
+		// A method expression.
+		mset := types.NewMethodSet(T)
+		for i := 0; i < mset.Len(); i++ {
+			c.addObject(mset.At(i).Obj(), 0)
+		}
+		return
+	}
+	for _, field := range fieldsOf(T) {
+		c.addObject(field, 0)
+	}
+	// Assume the value is addressable, so that methods with pointer
+	// receivers are offered too.
+	if _, isPtr := T.Underlying().(*types.Pointer); !isPtr && !types.IsInterface(T) {
+		T = types.NewPointer(T)
+	}
+	mset := types.NewMethodSet(T)
+	for i := 0; i < mset.Len(); i++ {
+		c.addObject(mset.At(i).Obj(), 0)
+	}
+}
+
+// fieldsOf returns the fields of the struct T or *T, including promoted
+// fields. Fields shadowed by shallower fields of the same name are omitted.
+func fieldsOf(T types.Type) []*types.Var {
+	var result []*types.Var
+	seen := make(map[string]bool)
+	visited := make(map[types.Type]bool)
+	level := []types.Type{T}
+	for len(level) > 0 {
+		var next []types.Type
+		found := make(map[string]bool) // names declared at this depth
+		for _, T := range level {
+			if ptr, ok := T.Underlying().(*types.Pointer); ok {
+				T = ptr.Elem()
+			}
+			if visited[T] {
+				continue
+			}
+			visited[T] = true
+			st, ok := T.Underlying().(*types.Struct)
+			if !ok {
+				continue
+			}
+			for i := 0; i < st.NumFields(); i++ {
+				field := st.Field(i)
+				if !seen[field.Name()] && !found[field.Name()] {
+					found[field.Name()] = true
+					result = append(result, field)
+				}
+				if field.Anonymous() {
+					next = append(next, field.Type())
+				}
+			}
+		}
+		for name := range found {
+			seen[name] = true
+		}
+		level = next
+	}
+	return result
+}
+
+// structLiteralKey returns the struct literal whose field name is being
+// typed at pos, if any. Literals with unkeyed elements are not considered.
+func (c *completer) structLiteralKey() (*ast.CompositeLit, bool) {
+	for _, n := range c.path {
+		switch n := n.(type) {
+		case *ast.Ident:
+			continue
+		case *ast.KeyValueExpr:
+			if c.pos > n.Colon {
+				return nil, false
+			}
+			continue
+		case *ast.CompositeLit:
+			if c.pos <= n.Lbrace || (n.Rbrace.IsValid() && c.pos > n.Rbrace) {
+				return nil, false
+			}
+			if _, ok := c.literalStruct(n); !ok {
+				return nil, false
+			}
+			for _, elt := range n.Elts {
+				_, keyed := elt.(*ast.KeyValueExpr)
+				current := elt.Pos() <= c.pos && c.pos <= elt.End()
+				if !keyed && !current {
+					return nil, false
+				}
+			}
+			return n, true
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// literalStruct returns the struct type of a composite literal.
+func (c *completer) literalStruct(lit *ast.CompositeLit) (*types.Struct, bool) {
+	tv, ok := c.pkg.Info.Types[lit]
+	if !ok || tv.Type == nil {
+		return nil, false
+	}
+	T := tv.Type.Underlying()
+	if ptr, ok := T.(*types.Pointer); ok {
+		T = ptr.Elem().Underlying()
+	}
+	st, ok := T.(*types.Struct)
+	return st, ok
+}
+
+func (c *completer) structFieldCandidates(lit *ast.CompositeLit) {
+	st, _ := c.literalStruct(lit)
+	used := make(map[string]bool)
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok && !(kv.Pos() <= c.pos && c.pos <= kv.End()) {
+			if key, ok := kv.Key.(*ast.Ident); ok {
+				used[key.Name] = true
+			}
+		}
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if used[field.Name()] || !(field.Exported() || field.Pkg() == c.pkg.Types) {
+			continue
+		}
+		if score, ok := fuzzyScore(c.prefix, field.Name()); ok {
+			item := c.objectItem(field)
+			item.InsertText = field.Name() + ": "
+			item.TextEdit.NewText = item.InsertText
+			c.add(item, score+scoreStructField)
+		}
+	}
+}
+
+// scope returns the innermost scope containing pos.
+func (c *completer) scope() *types.Scope {
+	if inner := c.pkg.Types.Scope().Innermost(c.pos); inner != nil {
+		return inner
+	}
+	return c.pkg.Types.Scope()
+}
+
+// scopeCandidates adds the objects in scope at pos, including those of the
+// universe scope.
+func (c *completer) scopeCandidates() {
+	inner := c.scope()
+	names := make(map[string]bool)
+	for s := inner; s != nil; s = s.Parent() {
+		for _, name := range s.Names() {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		if name == "_" {
+			continue
+		}
+		// LookupParent respects shadowing and, in function scopes,
+		// only finds objects declared before pos.
+		s, obj := inner.LookupParent(name, c.pos)
+		if obj == nil {
+			continue
+		}
+		if _, ok := obj.(*types.Label); ok {
+			continue
+		}
+		bonus := 0
+		switch s {
+		case types.Universe:
+		case c.pkg.Types.Scope():
+			bonus = scorePackageLevel
+		default:
+			if _, ok := obj.(*types.PkgName); ok {
+				// File scope.
+				break
+			}
+			bonus = scoreLocal
+		}
+		c.addObject(obj, bonus)
+	}
+}
+
+var (
+	// statementKeywords may begin a statement or type in a function body.
+	statementKeywords = []string{
+		"break", "case", "chan", "const", "continue", "default", "defer",
+		"else", "fallthrough", "for", "func", "go", "goto", "if",
+		"interface", "map", "range", "return", "select", "struct",
+		"switch", "type", "var",
+	}
+	// declarationKeywords may begin a top-level declaration.
+	declarationKeywords = []string{"const", "func", "import", "type", "var"}
+)
+
+// keywordCandidates adds the keywords that may appear at pos. They are only
+// offered once something has been typed.
+func (c *completer) keywordCandidates() {
+	if c.prefix == "" {
+		return
+	}
+	keywords := declarationKeywords
+	for _, n := range c.path {
+		if _, ok := n.(*ast.BlockStmt); ok {
+			keywords = statementKeywords
+			break
+		}
+	}
+	for _, kw := range keywords {
+		if score, ok := fuzzyScore(c.prefix, kw); ok {
+			c.add(c.item(kw, lsp.CIKKeyword, ""), score+scoreKeywordOffset)
+		}
+	}
+}
+
+// addObject adds obj as a candidate if it matches the prefix.
+func (c *completer) addObject(obj types.Object, bonus int) {
+	if !(obj.Exported() || obj.Pkg() == nil || obj.Pkg() == c.pkg.Types) {
+		return
+	}
+	score, ok := fuzzyScore(c.prefix, obj.Name())
+	if !ok {
+		return
+	}
+	c.add(c.objectItem(obj), score+bonus+c.typeScore(obj))
+}
+
+func (c *completer) add(item lsp.CompletionItem, score int) {
+	if c.seen[item.Label] {
+		return
+	}
+	c.seen[item.Label] = true
+	c.candidates = append(c.candidates, candidate{item: item, score: score})
+}
+
+// item returns a completion item replacing the identifier being typed with
+// label.
+func (c *completer) item(label string, kind lsp.CompletionItemKind, detail string) lsp.CompletionItem {
+	return lsp.CompletionItem{
+		Label:      label,
+		Kind:       int(kind),
+		Detail:     detail,
+		InsertText: label,
+		TextEdit:   &lsp.TextEdit{Range: c.rng, NewText: label},
+	}
+}
+
+func (c *completer) objectItem(obj types.Object) lsp.CompletionItem {
+	var (
+		kind   lsp.CompletionItemKind
+		detail string
+	)
+	switch obj := obj.(type) {
+	case *types.PkgName:
+		kind, detail = lsp.CIKModule, fmt.Sprintf("%q", obj.Imported().Path())
+	case *types.TypeName:
+		kind, detail = lsp.CIKClass, types.TypeString(obj.Type().Underlying(), c.qf)
+		switch obj.Type().Underlying().(type) {
+		case *types.Struct:
+			kind, detail = lsp.CIKStruct, "struct{...}"
+		case *types.Interface:
+			kind, detail = lsp.CIKInterface, "interface{...}"
+		}
+	case *types.Func:
+		kind, detail = lsp.CIKFunction, types.TypeString(obj.Type(), c.qf)
+		if obj.Type().(*types.Signature).Recv() != nil {
+			kind = lsp.CIKMethod
+		}
+	case *types.Builtin:
+		kind = lsp.CIKFunction
+	case *types.Var:
+		kind, detail = lsp.CIKVariable, types.TypeString(obj.Type(), c.qf)
+		if obj.IsField() {
+			kind = lsp.CIKField
+		}
+	case *types.Const:
+		kind, detail = lsp.CIKConstant, types.TypeString(obj.Type(), c.qf)
+	case *types.Nil:
+		kind = lsp.CIKValue
+	}
+	item := c.item(obj.Name(), kind, detail)
+	if data := c.completionData(obj); data != nil {
+		// The detail is filled in by completionItem/resolve, along
+		// with the documentation.
+		item.Detail = ""
+		item.Data = data
+	}
+	return item
+}
+
+// typeScore ranks obj by how well it fits the expected type.
+func (c *completer) typeScore(obj types.Object) int {
+	if c.expected == nil {
+		return 0
+	}
+	switch obj.(type) {
+	case *types.Var, *types.Const, *types.Nil:
+		if obj.Type() != nil && types.AssignableTo(obj.Type(), c.expected) {
+			return scoreAssignable
+		}
+	case *types.Func:
+		results := obj.Type().(*types.Signature).Results()
+		if results.Len() == 1 && types.AssignableTo(results.At(0).Type(), c.expected) {
+			return scoreCallable
+		}
+	}
+	return 0
+}
+
+// expectedType returns the type of the expression expected at pos, based on
+// the syntax enclosing it, or nil if it cannot tell.
+func (c *completer) expectedType() types.Type {
+	info := c.pkg.Info
+	typeOf := func(e ast.Expr) types.Type {
+		if tv, ok := info.Types[e]; ok {
+			return tv.Type
+		}
+		return nil
+	}
+	for i, n := range c.path {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if c.pos <= n.Lparen {
+				return nil
+			}
+			sig, ok := typeOf(n.Fun).(*types.Signature)
+			if !ok || sig.Params().Len() == 0 {
+				return nil
+			}
+			arg := exprIndex(n.Args, c.pos)
+			if sig.Variadic() && arg >= sig.Params().Len()-1 {
+				// The variadic parameter is a slice, except in the
+				// special case of append([]byte, string...).
+				T := sig.Params().At(sig.Params().Len() - 1).Type()
+				if s, ok := T.(*types.Slice); ok {
+					return s.Elem()
+				}
+				return T
+			}
+			if arg < sig.Params().Len() {
+				return sig.Params().At(arg).Type()
+			}
+			return nil
+
+		case *ast.AssignStmt:
+			if c.pos <= n.TokPos || len(n.Lhs) != len(n.Rhs) {
+				return nil
+			}
+			if i := exprIndex(n.Rhs, c.pos); i < len(n.Lhs) {
+				return typeOf(n.Lhs[i])
+			}
+			return nil
+
+		case *ast.ValueSpec:
+			if n.Type == nil || len(n.Names) == 0 || c.pos <= n.Names[len(n.Names)-1].End() {
+				return nil
+			}
+			return typeOf(n.Type)
+
+		case *ast.ReturnStmt:
+			sig := c.enclosingSignature(c.path[i+1:])
+			if sig == nil {
+				return nil
+			}
+			if i := exprIndex(n.Results, c.pos); i < sig.Results().Len() {
+				return sig.Results().At(i).Type()
+			}
+			return nil
+
+		case *ast.KeyValueExpr:
+			if c.pos <= n.Colon || i+1 >= len(c.path) {
+				return nil
+			}
+			lit, ok := c.path[i+1].(*ast.CompositeLit)
+			if !ok {
+				return nil
+			}
+			if key, ok := n.Key.(*ast.Ident); ok {
+				if field, ok := info.Uses[key].(*types.Var); ok && field.IsField() {
+					return field.Type()
+				}
+			}
+			return elementType(typeOf(lit))
+
+		case *ast.CompositeLit:
+			if c.pos <= n.Lbrace {
+				return nil
+			}
+			T := typeOf(n)
+			if st, ok := c.literalStruct(n); ok {
+				if i := exprIndex(n.Elts, c.pos); i < st.NumFields() {
+					return st.Field(i).Type()
+				}
+				return nil
+			}
+			return elementType(T)
+
+		case *ast.BinaryExpr:
+			if n.Op == token.LAND || n.Op == token.LOR {
+				return types.Typ[types.Bool]
+			}
+			if c.pos > n.OpPos {
+				return typeOf(n.X)
+			}
+			return typeOf(n.Y)
+
+		case *ast.SendStmt:
+			if c.pos <= n.Arrow {
+				return nil
+			}
+			if T := typeOf(n.Chan); T != nil {
+				if ch, ok := T.Underlying().(*types.Chan); ok {
+					return ch.Elem()
+				}
+			}
+			return nil
+
+		case *ast.Ident, *ast.SelectorExpr, *ast.BadExpr, *ast.ParenExpr:
+			continue
+		}
+		return nil
+	}
+	return nil
+}
+
+// enclosingSignature returns the signature of the innermost function in
+// path.
+func (c *completer) enclosingSignature(path []ast.Node) *types.Signature {
+	for _, n := range path {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			sig, _ := c.pkg.Info.Types[n].Type.(*types.Signature)
+			return sig
+		case *ast.FuncDecl:
+			if obj, ok := c.pkg.Info.Defs[n.Name].(*types.Func); ok {
+				return obj.Type().(*types.Signature)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// elementType returns the element type of a slice, array or map type, or
+// nil for other types.
+func elementType(T types.Type) types.Type {
+	if T == nil {
+		return nil
+	}
+	switch T := T.Underlying().(type) {
+	case *types.Slice:
+		return T.Elem()
+	case *types.Array:
+		return T.Elem()
+	case *types.Map:
+		return T.Elem()
+	}
+	return nil
+}
+
+// exprIndex returns the index of the expression in list that pos is in or
+// just after, or len(list) if pos is after all of them.
+func exprIndex(list []ast.Expr, pos token.Pos) int {
+	for i, e := range list {
+		if pos <= e.End() {
+			return i
+		}
+	}
+	return len(list)
+}
@@ -0,0 +1,174 @@
+package langserver
+
+import (
+	"context"
+	"encoding/json"
+	"go/build"
+	"go/token"
+	"go/types"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleCompletionItemResolve(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.CompletionItem) (lsp.CompletionItem, error) {
+	return resolveCompletionItem(h.checkBuildContext(ctx), h.resolvePackages, params)
+}
+
+// completionData identifies the object a completion item refers to, so that
+// completionItem/resolve can find it again. It is sent along with every item
+// in a completion list, hence the short keys.
+type completionData struct {
+	Package    string `json:"p"`
+	Name       string `json:"n,omitempty"` // "" for the package itself
+	Recv       string `json:"r,omitempty"` // the type declaring a field or method
+	Unimported bool   `json:"u,omitempty"` // the package is not imported yet
+}
+
+// completionData returns the data needed to resolve the item completing
+// obj, or nil if obj cannot be found again from outside the file, e.g.
+// because it is local to a function.
+func (c *completer) completionData(obj types.Object) *completionData {
+	if pkgName, ok := obj.(*types.PkgName); ok {
+		return &completionData{Package: pkgName.Imported().Path()}
+	}
+	if obj.Pkg() == nil || !obj.Pos().IsValid() {
+		return nil
+	}
+	if strings.HasSuffix(c.pkg.Fset.File(obj.Pos()).Name(), "_test.go") {
+		// Test files are not seen when importing the package.
+		return nil
+	}
+	data := &completionData{Package: obj.Pkg().Path(), Name: obj.Name()}
+	if obj.Parent() == obj.Pkg().Scope() {
+		return data
+	}
+	data.Recv = recvName(c.pkg, obj)
+	if data.Recv == "" {
+		return nil
+	}
+	return data
+}
+
+// resolveCompletionItem fills in the detail and documentation of a
+// completion item from its completionData. Items without data are returned
+// unchanged.
+func resolveCompletionItem(bctx *build.Context, cache *resolvePackages, item lsp.CompletionItem) (lsp.CompletionItem, error) {
+	if item.Data == nil {
+		return item, nil
+	}
+	// The data arrives as a generic JSON value.
+	b, err := json.Marshal(item.Data)
+	if err != nil {
+		return item, err
+	}
+	var data completionData
+	if err := json.Unmarshal(b, &data); err != nil || data.Package == "" {
+		return item, nil
+	}
+
+	pkg, err := cache.load(bctx, data.Package)
+	if err != nil {
+		return item, err
+	}
+	if data.Name == "" {
+		item.Detail = strconv.Quote(data.Package)
+		item.Documentation = packageDoc(pkg, data.Package)
+		return item, nil
+	}
+	obj := lookupCompletionObject(pkg.Types, data)
+	if obj == nil {
+		return item, nil
+	}
+	item.Detail = objectString(obj, qualifier(pkg.Types))
+	if data.Unimported {
+		item.Detail = strconv.Quote(data.Package) + " " + item.Detail
+	}
+	item.Documentation = docComment(pkg, obj)
+	return item, nil
+}
+
+// lookupCompletionObject finds the object described by data in pkg, or
+// returns nil if it no longer exists.
+func lookupCompletionObject(pkg *types.Package, data completionData) types.Object {
+	if data.Recv == "" {
+		return pkg.Scope().Lookup(data.Name)
+	}
+	recv, ok := pkg.Scope().Lookup(data.Recv).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	obj, _, _ := types.LookupFieldOrMethod(recv.Type(), true, pkg, data.Name)
+	return obj
+}
+
+// packageDoc returns the package comment of the package with the given
+// import path.
+func packageDoc(pkg *gotype.Package, importPath string) string {
+	for _, f := range pkg.Importer.Files(importPath) {
+		if f.Doc != nil {
+			return strings.TrimSpace(f.Doc.Text())
+		}
+	}
+	return ""
+}
+
+// resolvePackages caches the packages completion items are resolved
+// against, since clients resolve items one at a time as the user moves
+// through a completion list. A cached package is dropped when one of its
+// files changes; changes to its dependencies are not tracked, which at
+// worst leaves their documentation stale.
+type resolvePackages struct {
+	mu   sync.Mutex
+	pkgs map[string]*resolvedPackage // by import path
+}
+
+type resolvedPackage struct {
+	pkg *gotype.Package
+	dir string
+}
+
+func newResolvePackages() *resolvePackages {
+	return &resolvePackages{pkgs: make(map[string]*resolvedPackage)}
+}
+
+// invalidate forgets the package containing filename.
+func (x *resolvePackages) invalidate(filename string) {
+	dir := path.Dir(filename)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for importPath, p := range x.pkgs {
+		if p.dir == dir {
+			delete(x.pkgs, importPath)
+		}
+	}
+}
+
+// load type-checks the package with the given import path, ignoring
+// function bodies, or returns the cached result.
+func (x *resolvePackages) load(bctx *build.Context, importPath string) (*gotype.Package, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if p := x.pkgs[importPath]; p != nil {
+		return p.pkg, nil
+	}
+	bp, err := bctx.Import(importPath, "", build.FindOnly)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	imp := gotype.New(context.Background(), bctx, fset, make(map[string]*types.Package))
+	tpkg, err := imp.Import(importPath)
+	if tpkg == nil {
+		return nil, err
+	}
+	// Type errors still leave a usable package.
+	pkg := &gotype.Package{Fset: fset, Types: tpkg, Importer: imp}
+	x.pkgs[importPath] = &resolvedPackage{pkg: pkg, dir: bp.Dir}
+	return pkg, nil
+}
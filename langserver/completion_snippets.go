@@ -0,0 +1,149 @@
+package langserver
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+// snippetCandidates adds snippets for common statements when a statement
+// is being typed at pos. Like keywords, they are only offered once
+// something has been typed.
+func (c *completer) snippetCandidates() {
+	if !c.opts.snippets || c.prefix == "" || !c.atStatement() {
+		return
+	}
+	qf := fileQualifier(c.f, c.pkg.Types, c.pkg.Info)
+	sig := c.enclosingSignature(c.path)
+
+	if _, obj := c.scope().LookupParent("err", c.pos); obj != nil && isError(obj.Type()) {
+		c.addSnippet("if err != nil", "iferr", "if err != nil {\n\t"+returnZeroSnippet(sig, qf)+"\n}")
+	}
+	c.addSnippet("for range", "forrange", "for ${1:i}, ${2:v} := range ${3:x} {\n\t$0\n}")
+
+	if t := testingParam(sig); t != nil {
+		// The file imports testing, since t was declared in it.
+		typ := types.TypeString(t.Type(), qf)
+		c.addSnippet("tests", "tests", fmt.Sprintf(`tests := []struct {
+	name string
+	$1
+}{
+	{name: "$2"},
+}
+for _, tt := range tests {
+	%s.Run(tt.name, func(%s %s) {
+		$0
+	})
+}`, t.Name(), t.Name(), typ))
+		c.addSnippet(t.Name()+".Run", t.Name()+".Run", fmt.Sprintf("%s.Run(\"${1:name}\", func(%s %s) {\n\t$0\n})", t.Name(), t.Name(), typ))
+	}
+}
+
+// atStatement reports whether the identifier being typed at pos is a
+// statement of its own.
+func (c *completer) atStatement() bool {
+	if len(c.path) < 3 {
+		return false
+	}
+	ident, ok := c.path[0].(*ast.Ident)
+	if !ok {
+		return false
+	}
+	stmt, ok := c.path[1].(*ast.ExprStmt)
+	if !ok || stmt.X != ident {
+		return false
+	}
+	_, ok = c.path[2].(*ast.BlockStmt)
+	return ok
+}
+
+// addSnippet adds a snippet matched against filter.
+func (c *completer) addSnippet(label, filter, snippet string) {
+	score, ok := fuzzyScore(c.prefix, filter)
+	if !ok {
+		return
+	}
+	item := c.item(label, lsp.CIKSnippet, "")
+	item.FilterText = filter
+	item.InsertText = snippet
+	item.InsertTextFormat = lsp.ITFSnippet
+	item.TextEdit.NewText = snippet
+	c.add(item, score+scoreKeywordOffset)
+}
+
+// returnZeroSnippet returns a snippet for a return statement leaving a
+// function with signature sig because of an error held in err: the error
+// result is err and the other results are zero values, which are
+// placeholders.
+func returnZeroSnippet(sig *types.Signature, qf types.Qualifier) string {
+	if sig == nil || sig.Results().Len() == 0 {
+		return "return"
+	}
+	var buf bytes.Buffer
+	buf.WriteString("return ")
+	results := sig.Results()
+	for i := 0; i < results.Len(); i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		T := results.At(i).Type()
+		if i == results.Len()-1 && isError(T) {
+			buf.WriteString("err")
+			continue
+		}
+		fmt.Fprintf(&buf, "${%d:%s}", i+1, escapeSnippet(zeroValue(T, qf)))
+	}
+	return buf.String()
+}
+
+// zeroValue returns an expression for the zero value of T.
+func zeroValue(T types.Type, qf types.Qualifier) string {
+	if _, ok := T.(*types.TypeParam); ok {
+		return "*new(" + types.TypeString(T, qf) + ")"
+	}
+	switch u := T.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return "false"
+		case u.Info()&types.IsNumeric != 0:
+			return "0"
+		case u.Info()&types.IsString != 0:
+			return `""`
+		}
+	case *types.Struct, *types.Array:
+		return types.TypeString(T, qf) + "{}"
+	}
+	return "nil"
+}
+
+// isError reports whether T is the predeclared error type.
+func isError(T types.Type) bool {
+	return types.Identical(T, types.Universe.Lookup("error").Type())
+}
+
+// testingParam returns the parameter of sig of type *testing.T, or nil.
+func testingParam(sig *types.Signature) *types.Var {
+	if sig == nil {
+		return nil
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		v := sig.Params().At(i)
+		ptr, ok := v.Type().(*types.Pointer)
+		if !ok {
+			continue
+		}
+		named, ok := ptr.Elem().(*types.Named)
+		if ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "testing" && named.Obj().Name() == "T" && v.Name() != "" && v.Name() != "_" {
+			return v
+		}
+	}
+	return nil
+}
+
+// escapeSnippet escapes the characters that are special in snippet text.
+var escapeSnippet = strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`).Replace
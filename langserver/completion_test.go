@@ -0,0 +1,371 @@
+package langserver
+
+import (
+	"context"
+	"encoding/json"
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/buildutil"
+)
+
+// completionLabels returns the labels of the first n completions at the
+// position just after marker in src.
+func completionLabels(t *testing.T, pkgs map[string]map[string]string, src, marker string, n int) []string {
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+	p := positionOf(t, src, marker)
+	p.Character += len(marker)
+	list, err := completion(pkg, f, p, completionOptions{})
+	if err != nil {
+		t.Fatalf("%q: %v", marker, err)
+	}
+	var labels []string
+	for _, item := range list.Items {
+		if len(labels) == n {
+			break
+		}
+		labels = append(labels, item.Label)
+	}
+	return labels
+}
+
+func TestCompletion(t *testing.T) {
+	const a = `package a
+
+import "b"
+
+type T struct {
+	Name  string
+	count int
+	b.Embedded
+}
+
+func (t *T) Method() int { return 0 }
+
+func number() int { return 0 }
+
+func f(t T) {
+	var s string
+	var n int
+	n = nu
+	s = t.N
+	_ = T{Na}
+	_ = T{Name: "", co}
+	_ = b.F
+	if x := 1; x > 0 {
+		ret
+	}
+	_ = append([]byte{}, s...)
+	_, _ = s, n
+}
+`
+	pkgs := map[string]map[string]string{
+		"a": {"a.go": a},
+		"b": {"b.go": `package b
+
+type Embedded struct{ Promoted bool }
+
+func F()      {}
+func Fprint() {}
+func fhidden() {}
+`},
+	}
+	tests := []struct {
+		marker string
+		n      int
+		want   []string
+	}{
+		// Functions returning the expected type come first.
+		{"n = nu", 1, []string{"number"}},
+		{"s = t.N", 3, []string{"Name", "count"}},
+		{"T{Na", 1, []string{"Name"}},
+		{"\"\", co", 1, []string{"count"}},
+		{"b.F", 3, []string{"F", "Fprint"}},
+		{"\tret", 1, []string{"return"}},
+		{"{}, s", 1, []string{"s"}},
+	}
+	for _, test := range tests {
+		got := completionLabels(t, pkgs, a, test.marker, test.n)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.marker, got, test.want)
+		}
+	}
+}
+
+func TestCompletionSelectorWithoutName(t *testing.T) {
+	// "t." does not parse, but the package is still type-checked.
+	const a = `package a
+
+type T struct{ Field int }
+
+func (T) Method() {}
+
+func (*T) PtrMethod() {}
+
+type U struct {
+	T
+	Own bool
+}
+
+func f(u U) {
+	u.
+}
+`
+	pkgs := map[string]map[string]string{"a": {"a.go": a}}
+	got := completionLabels(t, pkgs, a, "u.", 10)
+	want := []string{"Field", "Method", "Own", "PtrMethod", "T"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCompletionUnimported(t *testing.T) {
+	const a = `package a
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Sprint
+
+func f() {
+	strings.Has
+}
+`
+	pkgs := map[string]map[string]string{
+		"a":                    {"a.go": a},
+		"strings":              {"strings.go": "package strings\n\nfunc HasPrefix(s, prefix string) bool { return false }\n\nfunc hasInternal() {}\n"},
+		"github.com/x/strings": {"s.go": "package strings\n\nfunc HasAnything() bool { return false }\n"},
+		"github.com/x/other":   {"s.go": "package other\n"},
+	}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+	bctx := buildutil.FakeContext(pkgs)
+	p := positionOf(t, a, "strings.Has")
+	p.Character += len("strings.Has")
+	list, err := completion(pkg, f, p, completionOptions{ctx: context.Background(), bctx: bctx, packages: newPackageIndex()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range list.Items {
+		got = append(got, item.Label+" "+item.Detail)
+	}
+	want := []string{`HasPrefix "strings"`, `HasAnything "github.com/x/strings"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	edited := applyEdits(t, a, list.Items[0].AdditionalTextEdits)
+	if !strings.Contains(edited, "import (\n\t\"fmt\"\n\t\"strings\"\n)") {
+		t.Errorf("import not added to the standard library group:\n%s", edited)
+	}
+}
+
+func TestPackageIndex(t *testing.T) {
+	pkgs := map[string]map[string]string{
+		"strings": {"strings.go": "package strings\n"},
+	}
+	bctx := buildutil.FakeContext(pkgs)
+	x := newPackageIndex()
+	paths := func(ctx context.Context) []string {
+		var paths []string
+		for _, decls := range x.lookup(ctx, bctx, "a", "strings") {
+			paths = append(paths, decls.importPath)
+		}
+		return paths
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := paths(ctx); got != nil {
+		t.Errorf("got %q with a cancelled context, want none", got)
+	}
+	if got, want := paths(context.Background()), []string{"strings"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Packages created later are found once their files are reported.
+	pkgs["github.com/x/strings"] = map[string]string{"s.go": "package strings\n"}
+	x.invalidate("/go/src/github.com/x/strings/s.go")
+	if got, want := paths(context.Background()), []string{"strings", "github.com/x/strings"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after creating a package: got %q, want %q", got, want)
+	}
+	delete(pkgs, "github.com/x/strings")
+	x.invalidate("/go/src/github.com/x/strings/s.go")
+	if got, want := paths(context.Background()), []string{"strings"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after deleting a package: got %q, want %q", got, want)
+	}
+}
+
+func TestCompletionItemResolve(t *testing.T) {
+	const a = `package a
+
+import "b"
+
+func f(t b.T) {
+	t.M
+	b.Ne
+}
+`
+	const b = `// Package b does things.
+package b
+
+// T is a thing.
+type T struct {
+	// Max is the largest value.
+	Max int
+}
+
+// Method does nothing.
+func (T) Method(x int) error { return nil }
+
+// New returns a T.
+func New() T { return T{} }
+`
+	pkgs := map[string]map[string]string{"a": {"a.go": a}, "b": {"b.go": b}}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+	bctx := buildutil.FakeContext(pkgs)
+	bctx.CgoEnabled = true
+	cache := newResolvePackages()
+
+	tests := []struct {
+		marker, label, detail, doc string
+	}{
+		{"t.M", "Method", "func (T).Method(x int) error", "Method does nothing."},
+		{"t.M", "Max", "field Max int", "Max is the largest value."},
+		{"b.Ne", "New", "func New() T", "New returns a T."},
+	}
+	for _, test := range tests {
+		p := positionOf(t, a, test.marker)
+		p.Character += len(test.marker)
+		list, err := completion(pkg, f, p, completionOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var item *lsp.CompletionItem
+		for i := range list.Items {
+			if list.Items[i].Label == test.label {
+				item = &list.Items[i]
+			}
+		}
+		if item == nil {
+			t.Fatalf("%s: no completion %q", test.marker, test.label)
+		}
+		if item.Detail != "" || item.Documentation != "" {
+			t.Errorf("%s: unresolved item has detail %q and documentation %q", test.label, item.Detail, item.Documentation)
+		}
+
+		// Send the item through JSON, as a client would.
+		b, err := json.Marshal(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sent lsp.CompletionItem
+		if err := json.Unmarshal(b, &sent); err != nil {
+			t.Fatal(err)
+		}
+		resolved, err := resolveCompletionItem(bctx, cache, sent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved.Detail != test.detail || resolved.Documentation != test.doc {
+			t.Errorf("%s: got detail %q and documentation %q, want %q and %q", test.label, resolved.Detail, resolved.Documentation, test.detail, test.doc)
+		}
+	}
+}
+
+func TestCompletionSnippets(t *testing.T) {
+	const a = `package a
+
+import (
+	"errors"
+	tst "testing"
+)
+
+type Point struct{ X, Y int }
+
+func load() (n int, s string, p Point, ok bool, ptr *Point, err error) {
+	err = errors.New("")
+	ife
+	return
+}
+
+func TestLoad(t *tst.T) {
+	tes
+	tru
+}
+`
+	pkgs := map[string]map[string]string{
+		"a":       {"a.go": a},
+		"errors":  {"errors.go": "package errors\n\nfunc New(text string) error { return nil }\n"},
+		"testing": {"testing.go": "package testing\n\ntype T struct{}\n\nfunc (t *T) Run(name string, f func(t *T)) bool { return true }\n"},
+	}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+	snippet := func(marker, label string) string {
+		p := positionOf(t, a, marker)
+		p.Character += len(marker)
+		list, err := completion(pkg, f, p, completionOptions{snippets: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range list.Items {
+			if item.Label == label {
+				if item.InsertTextFormat != lsp.ITFSnippet {
+					t.Errorf("%s: insert text format is %d", label, item.InsertTextFormat)
+				}
+				return item.TextEdit.NewText
+			}
+		}
+		t.Fatalf("%s: no snippet %q", marker, label)
+		return ""
+	}
+
+	if got, want := snippet("ife", "if err != nil"), "if err != nil {\n\treturn ${1:0}, ${2:\"\"}, ${3:Point{\\}}, ${4:false}, ${5:nil}, err\n}"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := snippet("\ttes", "tests"); !strings.Contains(got, "t.Run(tt.name, func(t *tst.T) {") {
+		t.Errorf("table-driven test does not call t.Run with the imported name:\n%s", got)
+	}
+	if got, want := snippet("\ttru", "t.Run"), "t.Run(\"${1:name}\", func(t *tst.T) {\n\t$0\n})"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	p := positionOf(t, a, "ife")
+	p.Character += len("ife")
+	list, err := completion(pkg, f, p, completionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range list.Items {
+		if item.Kind == int(lsp.CIKSnippet) {
+			t.Errorf("snippet %q offered to a client without snippet support", item.Label)
+		}
+	}
+}
+
+func TestZeroValue(t *testing.T) {
+	pkg := types.NewPackage("p", "p")
+	named := types.NewNamed(types.NewTypeName(0, pkg, "Kind", nil), types.Typ[types.Uint8], nil)
+	typeParam := types.NewTypeParam(types.NewTypeName(0, pkg, "T", nil), types.NewInterfaceType(nil, nil))
+	tests := []struct {
+		T    types.Type
+		want string
+	}{
+		{types.Typ[types.Int], "0"},
+		{types.Typ[types.String], `""`},
+		{types.Typ[types.Bool], "false"},
+		{named, "0"},
+		{types.NewSlice(types.Typ[types.Int]), "nil"},
+		{types.NewArray(types.Typ[types.Int], 2), "[2]int{}"},
+		{types.NewStruct(nil, nil), "struct{}{}"},
+		{types.Universe.Lookup("error").Type(), "nil"},
+		{typeParam, "*new(T)"},
+	}
+	for _, test := range tests {
+		if got := zeroValue(test.T, qualifier(pkg)); got != test.want {
+			t.Errorf("zeroValue(%s) = %q, want %q", test.T, got, test.want)
+		}
+	}
+}
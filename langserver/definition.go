@@ -0,0 +1,70 @@
+package langserver
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleDefinition(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) ([]lsp.Location, error) {
+	pkg, f, err := h.typecheck(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return definition(pkg, f, params.Position)
+}
+
+// definition returns the location of the declaration of the object at
+// position p in f. Builtin objects have no location, so an empty list is
+// returned for them.
+func definition(pkg *gotype.Package, f *ast.File, p lsp.Position) ([]lsp.Location, error) {
+	node, obj, err := objectAtPosition(pkg, f, p)
+	if err != nil {
+		return nil, err
+	}
+	if ident, ok := node.(*ast.Ident); ok {
+		// An embedded field defines a field but refers to a type;
+		// jumping to the type is more useful.
+		if use := pkg.Info.Uses[ident]; use != nil {
+			obj = use
+		}
+	}
+	if obj == nil {
+		return []lsp.Location{}, nil
+	}
+	loc, ok := objectLocation(pkg, obj)
+	if !ok {
+		return []lsp.Location{}, nil
+	}
+	return []lsp.Location{loc}, nil
+}
+
+// objectLocation returns the location of the declaration of obj, which may
+// be in the package itself or in a dependency loaded by its importer. The
+// location of a package name is the package clause of the imported package.
+func objectLocation(pkg *gotype.Package, obj types.Object) (lsp.Location, bool) {
+	if pkgName, ok := obj.(*types.PkgName); ok {
+		files := pkg.Importer.Files(pkgName.Imported().Path())
+		if len(files) == 0 {
+			return lsp.Location{}, false
+		}
+		// Prefer the file documenting the package.
+		f := files[0]
+		for _, f2 := range files {
+			if f2.Doc != nil {
+				f = f2
+				break
+			}
+		}
+		return locationForNode(pkg.Fset, f.Name), true
+	}
+	if !obj.Pos().IsValid() {
+		return lsp.Location{}, false
+	}
+	return locationForPos(pkg.Fset, obj.Pos(), obj.Pos()+token.Pos(len(obj.Name()))), true
+}
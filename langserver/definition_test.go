@@ -0,0 +1,162 @@
+package langserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+func TestDefinition(t *testing.T) {
+	const a = `package a
+
+import "b"
+
+type T struct {
+	b.S
+}
+
+func f() {
+	var t T
+	_ = t.S
+	b.G(1)
+}
+`
+	const b = `package b
+
+type S struct{}
+
+func G(x int) string { return undefined }
+`
+	pkgs := map[string]map[string]string{
+		"a": {"a.go": a},
+		"b": {"b.go": b},
+	}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	tests := []struct {
+		marker string
+		want   lsp.Location
+	}{
+		{"t T", lsp.Location{URI: "file:///go/src/a/a.go", Range: lsp.Range{Start: lsp.Position{Line: 9, Character: 5}, End: lsp.Position{Line: 9, Character: 6}}}},
+		{"T\n", lsp.Location{URI: "file:///go/src/a/a.go", Range: lsp.Range{Start: lsp.Position{Line: 4, Character: 5}, End: lsp.Position{Line: 4, Character: 6}}}},
+		// Embedded fields jump to the embedded type.
+		{"S\n}", lsp.Location{URI: "file:///go/src/b/b.go", Range: lsp.Range{Start: lsp.Position{Line: 2, Character: 5}, End: lsp.Position{Line: 2, Character: 6}}}},
+		// b has a type error, but its declarations are still usable.
+		{"G(1)", lsp.Location{URI: "file:///go/src/b/b.go", Range: lsp.Range{Start: lsp.Position{Line: 4, Character: 5}, End: lsp.Position{Line: 4, Character: 6}}}},
+		{`"b"`, lsp.Location{URI: "file:///go/src/b/b.go", Range: lsp.Range{Start: lsp.Position{Line: 0, Character: 8}, End: lsp.Position{Line: 0, Character: 9}}}},
+	}
+	for _, test := range tests {
+		locs, err := definition(pkg, f, positionOf(t, a, test.marker))
+		if err != nil {
+			t.Fatalf("%q: %v", test.marker, err)
+		}
+		if len(locs) != 1 || locs[0] != test.want {
+			t.Errorf("%q: got %+v, want %+v", test.marker, locs, test.want)
+		}
+	}
+}
+
+func TestXDefinition(t *testing.T) {
+	const a = `package a
+
+import "b"
+
+type T struct{ F int }
+
+func (T) M() {}
+
+var _ = T{}.F
+var _ = T{}.M
+var _ = b.V
+var _ = len("")
+`
+	pkgs := map[string]map[string]string{
+		"a": {"a.go": a},
+		"b": {"b.go": "package b\n\nvar V int\n"},
+	}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	tests := map[string]string{
+		"F\n":      "kind:field name:F package:a packageName:a recv:T vendor:false",
+		"M\n":      "kind:method name:M package:a packageName:a recv:T vendor:false",
+		"V\n":      "kind:var name:V package:b packageName:b recv: vendor:false",
+		"len":      "kind:func name:len package:builtin packageName:builtin recv: vendor:false",
+		"T struct": "kind:type name:T package:a packageName:a recv: vendor:false",
+	}
+	for marker, want := range tests {
+		syms, err := xdefinition(pkg, f, positionOf(t, a, marker))
+		if err != nil {
+			t.Fatalf("%q: %v", marker, err)
+		}
+		if len(syms) != 1 {
+			t.Fatalf("%q: got %d symbols, want 1", marker, len(syms))
+		}
+		if got := syms[0].Symbol.String(); got != want {
+			t.Errorf("%q: got %q, want %q", marker, got, want)
+		}
+	}
+}
+
+func TestUnvendoredPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		vendor bool
+	}{
+		{"github.com/a/b", "github.com/a/b", false},
+		{"vendor/golang.org/x/net", "golang.org/x/net", true},
+		{"github.com/a/b/vendor/github.com/c/d", "github.com/c/d", true},
+	}
+	for _, test := range tests {
+		got, vendor := unvendoredPath(test.path)
+		if got != test.want || vendor != test.vendor {
+			t.Errorf("%q: got (%q, %v), want (%q, %v)", test.path, got, vendor, test.want, test.vendor)
+		}
+	}
+}
+
+func TestTypeDefinition(t *testing.T) {
+	const a = `package a
+
+import "b"
+
+type K struct{}
+type V struct{}
+
+func f(p *b.S, m map[K][]V, c chan *K, n int) {
+	_, _, _, _ = p, m, c, n
+}
+`
+	pkgs := map[string]map[string]string{
+		"a": {"a.go": a},
+		"b": {"b.go": "package b\n\ntype S struct{}\n"},
+	}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	loc := func(file string, line, char int) lsp.Location {
+		return lsp.Location{
+			URI:   lsp.DocumentURI("file:///go/src/" + file),
+			Range: lsp.Range{Start: lsp.Position{Line: line, Character: char}, End: lsp.Position{Line: line, Character: char + 1}},
+		}
+	}
+	tests := []struct {
+		marker string
+		want   []lsp.Location
+	}{
+		{"p, m", []lsp.Location{loc("b/b.go", 2, 5)}},
+		{"m, c", []lsp.Location{loc("a/a.go", 4, 5), loc("a/a.go", 5, 5)}},
+		{"c, n", []lsp.Location{loc("a/a.go", 4, 5)}},
+		{"n\n", []lsp.Location{}},
+		{"f(", []lsp.Location{}},
+	}
+	for _, test := range tests {
+		locs, err := typeDefinition(pkg, f, positionOf(t, a, test.marker))
+		if err != nil {
+			t.Fatalf("%q: %v", test.marker, err)
+		}
+		if !reflect.DeepEqual(locs, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.marker, locs, test.want)
+		}
+	}
+}
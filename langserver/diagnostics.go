@@ -60,45 +60,56 @@ func (h *LangHandler) publishDiagnostics(ctx context.Context, conn jsonrpc2.JSON
 func errsToDiagnostics(typeErrs []error) (diagnostics, error) {
 	diags := diagnostics{}
 	for _, typeErr := range typeErrs {
-		var (
-			p   token.Position
-			msg string
-		)
-		switch e := typeErr.(type) {
-		case types.Error:
-			p = e.Fset.Position(e.Pos)
-			msg = e.Msg
-		case scanner.Error:
-			p = e.Pos
-			msg = e.Msg
-		case scanner.ErrorList:
-			if len(e) == 0 {
-				continue
-			}
-			p = e[0].Pos
-			msg = e[0].Msg
-			if len(e) > 1 {
-				msg = fmt.Sprintf("%s (and %d more errors)", msg, len(e)-1)
-			}
-		default:
-			return nil, fmt.Errorf("unexpected type error: %#+v", typeErr)
+		filename, diag, err := errorDiagnostic(typeErr)
+		if err != nil {
+			return nil, err
 		}
-		// LSP is 0-indexed, so subtract one from the numbers Go reports.
-		start := lsp.Position{Line: p.Line - 1, Character: p.Column - 1}
-		end := lsp.Position{Line: p.Line, Character: p.Column}
-		diag := &lsp.Diagnostic{
-			Range: lsp.Range{
-				Start: start,
-				End:   end,
-			},
-			Severity: lsp.Error,
-			Source:   "go",
-			Message:  strings.TrimSpace(msg),
+		if diag == nil {
+			continue
 		}
-		if diags == nil {
-			diags = diagnostics{}
-		}
-		diags[p.Filename] = append(diags[p.Filename], diag)
+		diags[filename] = append(diags[filename], diag)
 	}
 	return diags, nil
 }
+
+// errorDiagnostic returns the diagnostic reporting a type-checking or
+// parsing error, and the file it is in. The diagnostic is nil for an empty
+// error list.
+func errorDiagnostic(typeErr error) (string, *lsp.Diagnostic, error) {
+	var (
+		p   token.Position
+		msg string
+	)
+	switch e := typeErr.(type) {
+	case types.Error:
+		p = e.Fset.Position(e.Pos)
+		msg = e.Msg
+	case scanner.Error:
+		p = e.Pos
+		msg = e.Msg
+	case scanner.ErrorList:
+		if len(e) == 0 {
+			return "", nil, nil
+		}
+		p = e[0].Pos
+		msg = e[0].Msg
+		if len(e) > 1 {
+			msg = fmt.Sprintf("%s (and %d more errors)", msg, len(e)-1)
+		}
+	default:
+		return "", nil, fmt.Errorf("unexpected type error: %#+v", typeErr)
+	}
+	// LSP is 0-indexed, so subtract one from the numbers Go reports.
+	start := lsp.Position{Line: p.Line - 1, Character: p.Column - 1}
+	end := lsp.Position{Line: p.Line, Character: p.Column}
+	diag := &lsp.Diagnostic{
+		Range: lsp.Range{
+			Start: start,
+			End:   end,
+		},
+		Severity: lsp.Error,
+		Source:   "go",
+		Message:  strings.TrimSpace(msg),
+	}
+	return p.Filename, diag, nil
+}
@@ -0,0 +1,148 @@
+package langserver
+
+import (
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+// lineEdit replaces lines [start, end) of a text with lines.
+type lineEdit struct {
+	start, end int
+	lines      []string
+}
+
+// splitLines splits s into lines, each keeping its trailing newline. The
+// last line has none if s does not end in a newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest list of edits, in order, turning the lines
+// a into the lines b. It uses Myers' O(ND) algorithm after trimming the
+// lines the texts have in common at either end.
+func diffLines(a, b []string) []lineEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	edits := myers(a, b)
+	for i := range edits {
+		edits[i].start += prefix
+		edits[i].end += prefix
+	}
+	return edits
+}
+
+func myers(a, b []string) []lineEdit {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+	max := n + m
+	// v[max+k] is the furthest x reached on diagonal k = x - y. trace[d]
+	// holds v as it was before step d.
+	v := make([]int, 2*max+2)
+	var trace [][]int
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1] // down: insert b[y-1]
+			} else {
+				x = v[max+k-1] + 1 // right: delete a[x-1]
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk back from the end, collecting the edits in reverse.
+	var edits []lineEdit
+	insert := func(x int, line string) {
+		if len(edits) > 0 && edits[len(edits)-1].start == x {
+			e := &edits[len(edits)-1]
+			e.lines = append([]string{line}, e.lines...)
+			return
+		}
+		edits = append(edits, lineEdit{start: x, end: x, lines: []string{line}})
+	}
+	remove := func(x int) {
+		if len(edits) > 0 && edits[len(edits)-1].start == x+1 {
+			edits[len(edits)-1].start = x
+			return
+		}
+		edits = append(edits, lineEdit{start: x, end: x + 1})
+	}
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[max+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+		if x == prevX {
+			insert(x, b[prevY])
+		} else {
+			remove(prevX)
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// textEdits returns the edits turning before into after, replacing whole
+// lines.
+func textEdits(before, after string) []lsp.TextEdit {
+	a, b := splitLines(before), splitLines(after)
+	lineEdits := diffLines(a, b)
+	edits := make([]lsp.TextEdit, 0, len(lineEdits))
+	for _, e := range lineEdits {
+		edits = append(edits, lsp.TextEdit{
+			Range:   lsp.Range{Start: linePosition(a, e.start), End: linePosition(a, e.end)},
+			NewText: strings.Join(e.lines, ""),
+		})
+	}
+	return edits
+}
+
+// linePosition returns the position of the start of line i of lines, or of
+// the end of the text if i is past the last line.
+func linePosition(lines []string, i int) lsp.Position {
+	if i < len(lines) || len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lsp.Position{Line: i}
+	}
+	last := len(lines) - 1
+	return lsp.Position{Line: last, Character: len(lines[last])}
+}
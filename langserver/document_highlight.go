@@ -0,0 +1,175 @@
+package langserver
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleDocumentHighlight(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) ([]lsp.DocumentHighlight, error) {
+	// The build context reads through the overlay, so the type-checked
+	// file includes any unsaved edits.
+	pkg, f, err := h.typecheck(ctx, params.TextDocument.URI)
+	if err == nil {
+		return documentHighlights(pkg, f, params.Position)
+	}
+
+	// The package could not be type-checked at all, e.g. because the
+	// package clause of the file being edited does not parse.
+	// Highlighting identifiers with the same name is better than nothing.
+	contents, found := h.overlay.get(params.TextDocument.URI)
+	if !found {
+		if contents, err = h.readFile(ctx, params.TextDocument.URI); err != nil {
+			return nil, err
+		}
+	}
+	fset := token.NewFileSet()
+	f, _ = parser.ParseFile(fset, h.FilePath(params.TextDocument.URI), contents, 0)
+	if f == nil {
+		return []lsp.DocumentHighlight{}, nil
+	}
+	return syntacticHighlights(fset, f, params.Position)
+}
+
+// documentHighlights returns the occurrences in f of the object at position
+// p. Occurrences of variables are marked as reads or writes; declarations,
+// assignments, increments and keys of struct literals are writes. Other
+// objects are highlighted as text.
+func documentHighlights(pkg *gotype.Package, f *ast.File, p lsp.Position) ([]lsp.DocumentHighlight, error) {
+	_, obj, err := objectAtPosition(pkg, f, p)
+	if err != nil {
+		return nil, err
+	}
+	highlights := []lsp.DocumentHighlight{}
+	if obj == nil {
+		return highlights, nil
+	}
+	targets := map[types.Object]bool{obj: true}
+	writes := make(map[*ast.Ident]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				markWrite(writes, lhs)
+			}
+		case *ast.IncDecStmt:
+			markWrite(writes, n.X)
+		case *ast.RangeStmt:
+			if n.Tok == token.ASSIGN {
+				markWrite(writes, n.Key)
+				markWrite(writes, n.Value)
+			}
+		case *ast.KeyValueExpr:
+			if _, ok := pkg.Info.Uses[identOf(n.Key)].(*types.Var); ok {
+				markWrite(writes, n.Key)
+			}
+		case *ast.TypeSwitchStmt:
+			// The variable declared by a type switch guard is a
+			// separate object in each clause.
+			var guard *ast.Ident
+			if assign, ok := n.Assign.(*ast.AssignStmt); ok && len(assign.Lhs) == 1 {
+				guard, _ = assign.Lhs[0].(*ast.Ident)
+			}
+			var implicits []types.Object
+			found := false
+			for _, clause := range n.Body.List {
+				if obj := pkg.Info.Implicits[clause]; obj != nil {
+					implicits = append(implicits, obj)
+					found = found || targets[obj]
+				}
+			}
+			if found && guard != nil {
+				for _, obj := range implicits {
+					targets[obj] = true
+				}
+				highlights = append(highlights, lsp.DocumentHighlight{Range: rangeForNode(pkg.Fset, guard), Kind: lsp.Write})
+			}
+		}
+		return true
+	})
+
+	_, isVar := obj.(*types.Var)
+	add := func(ident *ast.Ident, obj types.Object) {
+		if obj == nil || !targets[obj] || ident.Pos() < f.Pos() || ident.Pos() > f.End() {
+			return
+		}
+		kind := int(lsp.Text)
+		if isVar {
+			kind = lsp.Read
+			if writes[ident] || pkg.Info.Defs[ident] != nil {
+				kind = lsp.Write
+			}
+		}
+		highlights = append(highlights, lsp.DocumentHighlight{Range: rangeForNode(pkg.Fset, ident), Kind: kind})
+	}
+	for ident, obj := range pkg.Info.Defs {
+		add(ident, obj)
+	}
+	for ident, obj := range pkg.Info.Uses {
+		add(ident, obj)
+	}
+	sortHighlights(highlights)
+	return highlights, nil
+}
+
+// syntacticHighlights returns the occurrences in f of identifiers with the
+// same name as the one at position p, without distinguishing reads and
+// writes.
+func syntacticHighlights(fset *token.FileSet, f *ast.File, p lsp.Position) ([]lsp.DocumentHighlight, error) {
+	path, _, err := pathEnclosingPosition(fset, f, p)
+	if err != nil {
+		return nil, err
+	}
+	highlights := []lsp.DocumentHighlight{}
+	target, ok := path[0].(*ast.Ident)
+	if !ok {
+		return highlights, nil
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == target.Name {
+			highlights = append(highlights, lsp.DocumentHighlight{Range: rangeForNode(fset, ident), Kind: int(lsp.Text)})
+		}
+		return true
+	})
+	return highlights, nil
+}
+
+// markWrite records the identifier written to by assigning to expr, if any.
+func markWrite(writes map[*ast.Ident]bool, expr ast.Expr) {
+	if ident := identOf(expr); ident != nil {
+		writes[ident] = true
+	}
+}
+
+// identOf returns the identifier naming the variable or field denoted by
+// expr, or nil if it is not a plain (possibly qualified or parenthesized)
+// name.
+func identOf(expr ast.Expr) *ast.Ident {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e
+	case *ast.SelectorExpr:
+		return e.Sel
+	case *ast.ParenExpr:
+		return identOf(e.X)
+	}
+	return nil
+}
+
+// sortHighlights sorts highlights by position.
+func sortHighlights(highlights []lsp.DocumentHighlight) {
+	sort.Slice(highlights, func(i, j int) bool {
+		a, b := highlights[i].Range.Start, highlights[j].Range.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Character < b.Character
+	})
+}
@@ -0,0 +1,69 @@
+package langserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+func TestDocumentHighlights(t *testing.T) {
+	const a = `package a
+
+type T struct{ F int }
+
+func f(x interface{}) {
+	t := T{F: 1}
+	t.F++
+	_ = t.F
+	switch v := x.(type) {
+	case int:
+		_ = v
+	case string:
+		_ = v
+	}
+}
+`
+	pkg, f := typecheckFake(t, map[string]map[string]string{"a": {"a.go": a}}, "/go/src/a/a.go")
+
+	highlight := func(line, char, n, kind int) lsp.DocumentHighlight {
+		return lsp.DocumentHighlight{
+			Range: lsp.Range{Start: lsp.Position{Line: line, Character: char}, End: lsp.Position{Line: line, Character: char + n}},
+			Kind:  kind,
+		}
+	}
+	tests := []struct {
+		marker string
+		want   []lsp.DocumentHighlight
+	}{
+		{"F int", []lsp.DocumentHighlight{
+			highlight(2, 15, 1, lsp.Write),
+			highlight(5, 8, 1, lsp.Write),
+			highlight(6, 3, 1, lsp.Write),
+			highlight(7, 7, 1, lsp.Read),
+		}},
+		{"t :=", []lsp.DocumentHighlight{
+			highlight(5, 1, 1, lsp.Write),
+			highlight(6, 1, 1, lsp.Read),
+			highlight(7, 5, 1, lsp.Read),
+		}},
+		{"T{", []lsp.DocumentHighlight{
+			highlight(2, 5, 1, int(lsp.Text)),
+			highlight(5, 6, 1, int(lsp.Text)),
+		}},
+		{"v\n\tcase string", []lsp.DocumentHighlight{
+			highlight(8, 8, 1, lsp.Write),
+			highlight(10, 6, 1, lsp.Read),
+			highlight(12, 6, 1, lsp.Read),
+		}},
+	}
+	for _, test := range tests {
+		got, err := documentHighlights(pkg, f, positionOf(t, a, test.marker))
+		if err != nil {
+			t.Fatalf("%q: %v", test.marker, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.marker, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleDocumentSymbol(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.DocumentSymbolParams) (interface{}, error) {
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	// An outline of a partially parsed file is better than none, so
+	// syntax errors are ignored.
+	f, _ := parser.ParseFile(fset, h.FilePath(params.TextDocument.URI), contents, 0)
+	if f == nil {
+		return []lsp.SymbolInformation{}, nil
+	}
+	syms := documentSymbols(fset, f)
+	if h.init.Capabilities.TextDocument.DocumentSymbol.HierarchicalDocumentSymbolSupport {
+		return syms, nil
+	}
+	return flattenSymbols(params.TextDocument.URI, syms, "", []lsp.SymbolInformation{}), nil
+}
+
+// documentSymbols returns the outline of f. Methods are nested under their
+// receiver type if it is declared in f, and fields and interface methods
+// under their type. The range of a type spans its methods, since editors
+// follow the cursor in the outline by range containment.
+func documentSymbols(fset *token.FileSet, f *ast.File) []lsp.DocumentSymbol {
+	syms := []lsp.DocumentSymbol{}
+	typeIndex := make(map[string]int) // type name -> index in syms
+	var methods []*ast.FuncDecl
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				// Handled once all types are known.
+				methods = append(methods, decl)
+				continue
+			}
+			syms = append(syms, funcSymbol(fset, decl, lsp.SKFunction))
+
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					typeIndex[spec.Name.Name] = len(syms)
+					syms = append(syms, typeSymbol(fset, specNode(decl, spec), spec))
+
+				case *ast.ValueSpec:
+					kind := lsp.SKVariable
+					if decl.Tok == token.CONST {
+						kind = lsp.SKConstant
+					}
+					for _, name := range spec.Names {
+						if name.Name == "_" {
+							continue
+						}
+						syms = append(syms, lsp.DocumentSymbol{
+							Name:           name.Name,
+							Detail:         exprString(spec.Type),
+							Kind:           kind,
+							Range:          rangeForNode(fset, specNode(decl, spec)),
+							SelectionRange: rangeForNode(fset, name),
+						})
+					}
+				}
+			}
+		}
+	}
+
+	for _, m := range methods {
+		sym := funcSymbol(fset, m, lsp.SKMethod)
+		recv := m.Recv.List[0].Type
+		if i, ok := typeIndex[receiverBaseName(recv)]; ok {
+			syms[i].Children = append(syms[i].Children, sym)
+			if positionBefore(sym.Range.Start, syms[i].Range.Start) {
+				syms[i].Range.Start = sym.Range.Start
+			}
+			if positionBefore(syms[i].Range.End, sym.Range.End) {
+				syms[i].Range.End = sym.Range.End
+			}
+			continue
+		}
+		sym.Name = fmt.Sprintf("(%s).%s", exprString(recv), sym.Name)
+		syms = append(syms, sym)
+	}
+	return syms
+}
+
+func funcSymbol(fset *token.FileSet, decl *ast.FuncDecl, kind lsp.SymbolKind) lsp.DocumentSymbol {
+	return lsp.DocumentSymbol{
+		Name:           decl.Name.Name,
+		Detail:         exprString(decl.Type),
+		Kind:           kind,
+		Range:          rangeForNode(fset, decl),
+		SelectionRange: rangeForNode(fset, decl.Name),
+	}
+}
+
+func typeSymbol(fset *token.FileSet, node ast.Node, spec *ast.TypeSpec) lsp.DocumentSymbol {
+	sym := lsp.DocumentSymbol{
+		Name:           spec.Name.Name,
+		Detail:         exprString(spec.Type),
+		Kind:           lsp.SKClass,
+		Range:          rangeForNode(fset, node),
+		SelectionRange: rangeForNode(fset, spec.Name),
+	}
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		sym.Detail = "struct"
+		sym.Children = fieldSymbols(fset, t.Fields, lsp.SKField)
+	case *ast.InterfaceType:
+		sym.Detail = "interface"
+		sym.Kind = lsp.SKInterface
+		sym.Children = fieldSymbols(fset, t.Methods, lsp.SKMethod)
+	}
+	return sym
+}
+
+// fieldSymbols returns symbols for the struct fields or interface methods in
+// fields. Embedded fields are named after their type.
+func fieldSymbols(fset *token.FileSet, fields *ast.FieldList, kind lsp.SymbolKind) []lsp.DocumentSymbol {
+	var syms []lsp.DocumentSymbol
+	if fields == nil {
+		return syms
+	}
+	for _, field := range fields.List {
+		if len(field.Names) == 0 {
+			embeddedKind := lsp.SKField
+			if kind == lsp.SKMethod {
+				embeddedKind = lsp.SKInterface
+			}
+			syms = append(syms, lsp.DocumentSymbol{
+				Name:           exprString(field.Type),
+				Kind:           embeddedKind,
+				Range:          rangeForNode(fset, field),
+				SelectionRange: rangeForNode(fset, field.Type),
+			})
+			continue
+		}
+		for _, name := range field.Names {
+			sym := lsp.DocumentSymbol{
+				Name:           name.Name,
+				Detail:         exprString(field.Type),
+				Kind:           kind,
+				Range:          rangeForNode(fset, field),
+				SelectionRange: rangeForNode(fset, name),
+			}
+			if st, ok := field.Type.(*ast.StructType); ok {
+				sym.Detail = "struct"
+				sym.Children = fieldSymbols(fset, st.Fields, lsp.SKField)
+			}
+			syms = append(syms, sym)
+		}
+	}
+	return syms
+}
+
+// specNode returns the node spanning the declaration of spec. For specs
+// outside a parenthesized group that is the whole GenDecl, so that the range
+// includes the keyword.
+func specNode(decl *ast.GenDecl, spec ast.Spec) ast.Node {
+	if !decl.Lparen.IsValid() {
+		return decl
+	}
+	return spec
+}
+
+// receiverBaseName returns the name of the type in a method receiver,
+// e.g. "T" for "*T" or "T[K]".
+func receiverBaseName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// exprString is like types.ExprString, but returns "" for a nil expression.
+func exprString(expr ast.Expr) string {
+	if expr == nil {
+		return ""
+	}
+	return types.ExprString(expr)
+}
+
+// flattenSymbols appends syms and their children to result as a flat list
+// of SymbolInformation, for clients that do not support hierarchical
+// document symbols.
+func flattenSymbols(uri lsp.DocumentURI, syms []lsp.DocumentSymbol, container string, result []lsp.SymbolInformation) []lsp.SymbolInformation {
+	for _, sym := range syms {
+		result = append(result, lsp.SymbolInformation{
+			Name:          sym.Name,
+			Kind:          sym.Kind,
+			Location:      lsp.Location{URI: uri, Range: sym.Range},
+			ContainerName: container,
+		})
+		result = flattenSymbols(uri, sym.Children, sym.Name, result)
+	}
+	return result
+}
@@ -0,0 +1,137 @@
+package langserver
+
+import (
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+func TestDocumentSymbols(t *testing.T) {
+	const src = `package a
+
+import "io"
+
+const Max = 3
+
+type T struct {
+	io.Reader
+	*Base
+	a, b int
+	opts struct{ X int }
+}
+
+type I interface {
+	io.Closer
+	M() error
+}
+
+func F() {}
+
+func (t *T) M() error { return nil }
+
+func (o Other) N() {}
+
+func (t T) P() {}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "/a.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syms := documentSymbols(fset, f)
+
+	type symbol struct {
+		Name     string
+		Kind     lsp.SymbolKind
+		Children []symbol
+	}
+	var simplify func([]lsp.DocumentSymbol) []symbol
+	simplify = func(syms []lsp.DocumentSymbol) []symbol {
+		var s []symbol
+		for _, sym := range syms {
+			s = append(s, symbol{sym.Name, sym.Kind, simplify(sym.Children)})
+		}
+		return s
+	}
+	want := []symbol{
+		{Name: "Max", Kind: lsp.SKConstant},
+		{Name: "T", Kind: lsp.SKClass, Children: []symbol{
+			{Name: "io.Reader", Kind: lsp.SKField},
+			{Name: "*Base", Kind: lsp.SKField},
+			{Name: "a", Kind: lsp.SKField},
+			{Name: "b", Kind: lsp.SKField},
+			{Name: "opts", Kind: lsp.SKField, Children: []symbol{
+				{Name: "X", Kind: lsp.SKField},
+			}},
+			{Name: "M", Kind: lsp.SKMethod},
+			{Name: "P", Kind: lsp.SKMethod},
+		}},
+		{Name: "I", Kind: lsp.SKInterface, Children: []symbol{
+			{Name: "io.Closer", Kind: lsp.SKInterface},
+			{Name: "M", Kind: lsp.SKMethod},
+		}},
+		{Name: "F", Kind: lsp.SKFunction},
+		{Name: "(Other).N", Kind: lsp.SKMethod},
+	}
+	if got := simplify(syms); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Editors follow the cursor by range containment, so children must
+	// lie within their parent.
+	var checkRanges func([]lsp.DocumentSymbol)
+	checkRanges = func(syms []lsp.DocumentSymbol) {
+		for _, sym := range syms {
+			if positionBefore(sym.SelectionRange.Start, sym.Range.Start) || positionBefore(sym.Range.End, sym.SelectionRange.End) {
+				t.Errorf("%s: selection range %v is outside range %v", sym.Name, sym.SelectionRange, sym.Range)
+			}
+			for _, child := range sym.Children {
+				if positionBefore(child.Range.Start, sym.Range.Start) || positionBefore(sym.Range.End, child.Range.End) {
+					t.Errorf("%s: range %v is outside that of %s, %v", child.Name, child.Range, sym.Name, sym.Range)
+				}
+			}
+			checkRanges(sym.Children)
+		}
+	}
+	checkRanges(syms)
+
+	var got []string
+	for _, sym := range flattenSymbols("file:///a.go", syms, "", nil) {
+		got = append(got, sym.ContainerName+"/"+sym.Name)
+	}
+	wantFlat := []string{
+		"/Max",
+		"/T", "T/io.Reader", "T/*Base", "T/a", "T/b", "T/opts", "opts/X", "T/M", "T/P",
+		"/I", "I/io.Closer", "I/M",
+		"/F", "/(Other).N",
+	}
+	if !reflect.DeepEqual(got, wantFlat) {
+		t.Errorf("flat symbols: got %q, want %q", got, wantFlat)
+	}
+}
+
+func TestReceiverBaseName(t *testing.T) {
+	tests := map[string]string{
+		"T":         "T",
+		"*T":        "T",
+		"(*T)":      "T",
+		"T[K]":      "T",
+		"*T[K, V]":  "T",
+		"pkg.T":     "",
+		"[]T":       "",
+		"func() T":  "",
+		"*(T[int])": "T",
+	}
+	for src, want := range tests {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := receiverBaseName(expr); got != want {
+			t.Errorf("%s: got %q, want %q", src, got, want)
+		}
+	}
+}
@@ -0,0 +1,576 @@
+package langserver
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// selection returns the range r of f as positions, without the whitespace
+// at either end.
+func selection(pkg *gotype.Package, f *ast.File, src []byte, r lsp.Range) (start, end token.Pos, err error) {
+	tf := pkg.Fset.File(f.Pos())
+	if start, err = posForPosition(tf, r.Start); err != nil {
+		return token.NoPos, token.NoPos, err
+	}
+	if end, err = posForPosition(tf, r.End); err != nil {
+		return token.NoPos, token.NoPos, err
+	}
+	s, e := tf.Offset(start), tf.Offset(end)
+	for s < e && isSpace(src[s]) {
+		s++
+	}
+	for e > s && isSpace(src[e-1]) {
+		e--
+	}
+	return tf.Pos(s), tf.Pos(e), nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// lineIndent returns the indentation of the line containing pos in src,
+// and whether pos is at its end, i.e. only the indentation precedes pos on
+// its line.
+func lineIndent(fset *token.FileSet, src []byte, pos token.Pos) (indent string, atIndent bool) {
+	offset := fset.File(pos).Offset(pos)
+	start := offset
+	for start > 0 && src[start-1] != '\n' {
+		start--
+	}
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[start:end]), end == offset
+}
+
+// lineStartPos returns the position of the start of the line containing
+// pos.
+func lineStartPos(fset *token.FileSet, pos token.Pos) token.Pos {
+	tf := fset.File(pos)
+	return tf.LineStart(tf.Line(pos))
+}
+
+// insertBefore returns an edit inserting the statement text before stmt: on
+// a line of its own if stmt starts its line, else on the same line.
+func insertBefore(fset *token.FileSet, src []byte, stmt ast.Node, text string) lsp.TextEdit {
+	indent, atIndent := lineIndent(fset, src, stmt.Pos())
+	if atIndent {
+		pos := positionForPos(fset, lineStartPos(fset, stmt.Pos()))
+		return lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: indent + strings.Replace(text, "\n", "\n"+indent, -1) + "\n"}
+	}
+	pos := positionForPos(fset, stmt.Pos())
+	return lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: strings.Replace(text, "\n", "; ", -1) + "; "}
+}
+
+// freshName returns base, or base followed by a number, whichever is first
+// to be unused both in the scope at pos and anywhere in body.
+func freshName(pkg *gotype.Package, body ast.Node, pos token.Pos, base string) string {
+	scope := pkg.Types.Scope().Innermost(pos)
+	if scope == nil {
+		scope = pkg.Types.Scope()
+	}
+	for i := 0; ; i++ {
+		name := base
+		if i > 0 {
+			name += strconv.Itoa(i)
+		}
+		if _, obj := scope.LookupParent(name, pos); obj == nil && !mentionsName(body, name) {
+			return name
+		}
+	}
+}
+
+// mentionsName reports whether an identifier named name appears in n.
+func mentionsName(n ast.Node, name string) bool {
+	found := false
+	ast.Inspect(n, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == name {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// isLocalObject reports whether obj is declared within a function of pkg.
+func isLocalObject(pkg *types.Package, obj types.Object) bool {
+	if obj.Pkg() != pkg || obj.Parent() == nil {
+		return false // fields and methods have no parent
+	}
+	return obj.Parent() != pkg.Scope() && obj.Parent() != types.Universe
+}
+
+// extractVariable returns the edits declaring a variable initialized to the
+// expression between start and end, before the statement it is in, and
+// replacing the expression by the variable.
+func extractVariable(pkg *gotype.Package, f *ast.File, src []byte, start, end token.Pos) ([]lsp.TextEdit, error) {
+	path, _ := astutil.PathEnclosingInterval(f, start, end)
+	expr, ok := path[0].(ast.Expr)
+	if !ok || expr.Pos() != start || expr.End() != end {
+		return nil, errors.New("the selection is not an expression")
+	}
+	tv, ok := pkg.Info.Types[expr]
+	if !ok || !tv.IsValue() {
+		return nil, errors.New("the selection is not a value")
+	}
+	if _, ok := tv.Type.(*types.Tuple); ok {
+		return nil, errors.New("the selection has several values")
+	}
+	if b, ok := tv.Type.(*types.Basic); ok && b.Kind() == types.UntypedNil {
+		return nil, errors.New("the selection is nil")
+	}
+	switch parent := path[1].(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range parent.Lhs {
+			if lhs == expr {
+				return nil, errors.New("the selection is assigned to")
+			}
+		}
+	case *ast.IncDecStmt:
+		return nil, errors.New("the selection is assigned to")
+	case *ast.UnaryExpr:
+		if parent.Op == token.AND {
+			return nil, errors.New("the address of the selection is taken")
+		}
+	}
+
+	// Declare the variable before the statement evaluating the
+	// expression.
+	stmt, err := evaluatingStmt(path, "the selection")
+	if err != nil {
+		return nil, err
+	}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && err == nil {
+			if obj := pkg.Info.Uses[id]; obj != nil && obj.Pos() >= stmt.Pos() && obj.Pos() < stmt.End() {
+				err = fmt.Errorf("the selection refers to %s, which is declared in the same statement", id.Name)
+			}
+		}
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	name := freshName(pkg, enclosingFuncBody(path), stmt.Pos(), "x")
+	text := name + " := " + string(src[pkg.Fset.File(start).Offset(start):pkg.Fset.File(end).Offset(end)])
+	return []lsp.TextEdit{
+		insertBefore(pkg.Fset, src, stmt, text),
+		{Range: rangeForPos(pkg.Fset, start, end), NewText: name},
+	}, nil
+}
+
+// evaluatingStmt returns the statement of a statement list that contains
+// path[0] and evaluates it exactly once whenever it is executed. The
+// description what of path[0] is used in errors.
+func evaluatingStmt(path []ast.Node, what string) (ast.Stmt, error) {
+	child := path[0]
+	for i, n := range path[1:] {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return nil, fmt.Errorf("%s is in a function literal", what)
+		case *ast.BinaryExpr:
+			if (n.Op == token.LAND || n.Op == token.LOR) && child == n.Y {
+				return nil, fmt.Errorf("%s is conditionally evaluated", what)
+			}
+		case *ast.IfStmt:
+			if child != n.Init && child != n.Cond {
+				return nil, fmt.Errorf("%s is conditionally evaluated", what)
+			}
+		case *ast.ForStmt:
+			if child != n.Init {
+				return nil, fmt.Errorf("%s is evaluated repeatedly", what)
+			}
+		case *ast.SwitchStmt:
+			if child != n.Init && child != n.Tag {
+				return nil, fmt.Errorf("%s is conditionally evaluated", what)
+			}
+		case *ast.TypeSwitchStmt:
+			if child != n.Init && child != n.Assign {
+				return nil, fmt.Errorf("%s is conditionally evaluated", what)
+			}
+		case *ast.CaseClause, *ast.CommClause:
+			return nil, fmt.Errorf("%s is conditionally evaluated", what)
+		}
+		if s, ok := n.(ast.Stmt); ok && inStmtList(path[i+2:]) {
+			return s, nil
+		}
+		child = n
+	}
+	return nil, fmt.Errorf("%s is not in a statement", what)
+}
+
+// enclosingFuncBody returns the body of the innermost function in path, or
+// nil if there is none.
+func enclosingFuncBody(path []ast.Node) *ast.BlockStmt {
+	for _, n := range path {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			return n.Body
+		case *ast.FuncLit:
+			return n.Body
+		}
+	}
+	return nil
+}
+
+// extractFunction returns the edits moving the statements between start
+// and end into a new function, declared after the declaration containing
+// them, and calling it in their place. The variables the statements use
+// from the enclosing function become parameters; those they assign to, and
+// those they declare that are used after them, become results.
+func extractFunction(pkg *gotype.Package, f *ast.File, src []byte, start, end token.Pos) ([]lsp.TextEdit, error) {
+	path, _ := astutil.PathEnclosingInterval(f, start, end)
+	var (
+		stmts []ast.Stmt
+		block ast.Node
+	)
+	for _, n := range path {
+		var list []ast.Stmt
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			list = n.List
+		case *ast.CaseClause:
+			list = n.Body
+		case *ast.CommClause:
+			list = n.Body
+		default:
+			continue
+		}
+		for _, s := range list {
+			if s.Pos() >= start && s.End() <= end {
+				stmts = append(stmts, s)
+			}
+		}
+		block = n
+		break
+	}
+	if len(stmts) == 0 || stmts[0].Pos() != start || stmts[len(stmts)-1].End() != end {
+		return nil, errors.New("the selection is not a list of statements")
+	}
+	body := enclosingFuncBody(path)
+	if body == nil {
+		return nil, errors.New("the selection is not in a function")
+	}
+	decl := path[len(path)-2] // the top-level declaration
+	fset := pkg.Fset
+	inside := func(pos token.Pos) bool { return pos >= start && pos < end }
+
+	// Collect the variables the statements use and declare, and check
+	// that they can be moved.
+	var (
+		params   []*types.Var
+		isParam  = make(map[*types.Var]bool)
+		assigned = make(map[*types.Var]bool)
+		declared = make(map[*types.Var]bool)
+		err      error
+		stack    []ast.Node
+	)
+	markAssigned := func(e ast.Expr) {
+		if v := assignedVar(pkg.Info, e); v != nil {
+			assigned[v] = true
+		}
+	}
+	inFuncLit := func() bool {
+		for _, n := range stack {
+			if _, ok := n.(*ast.FuncLit); ok {
+				return true
+			}
+		}
+		return false
+	}
+	for _, s := range stmts {
+		ast.Inspect(s, func(n ast.Node) bool {
+			if err != nil {
+				return false
+			}
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			switch n := n.(type) {
+			case *ast.Ident:
+				switch obj := pkg.Info.Uses[n].(type) {
+				case *types.Var:
+					if isLocalObject(pkg.Types, obj) && !inside(obj.Pos()) && !isParam[obj] {
+						isParam[obj] = true
+						params = append(params, obj)
+					}
+				case *types.TypeName, *types.Const:
+					if isLocalObject(pkg.Types, obj) && !inside(obj.Pos()) {
+						err = fmt.Errorf("the selection refers to the local %s", obj.Name())
+					}
+				}
+				if v, ok := pkg.Info.Defs[n].(*types.Var); ok {
+					declared[v] = true
+				}
+			case *ast.AssignStmt:
+				for _, lhs := range n.Lhs {
+					markAssigned(lhs)
+				}
+			case *ast.IncDecStmt:
+				markAssigned(n.X)
+			case *ast.RangeStmt:
+				if n.Tok == token.ASSIGN {
+					markAssigned(n.Key)
+					if n.Value != nil {
+						markAssigned(n.Value)
+					}
+				}
+			case *ast.UnaryExpr:
+				if id, ok := n.X.(*ast.Ident); ok && n.Op == token.AND {
+					if v, ok := pkg.Info.Uses[id].(*types.Var); ok && isLocalObject(pkg.Types, v) && !inside(v.Pos()) {
+						err = fmt.Errorf("the selection takes the address of %s", id.Name)
+					}
+				}
+			case *ast.SelectorExpr:
+				// Calling a method with a pointer receiver on a
+				// variable may change it.
+				if sel := pkg.Info.Selections[n]; sel != nil && sel.Kind() == types.MethodVal && !isPointer(pkg.Info.TypeOf(n.X)) {
+					if sig, ok := sel.Obj().Type().(*types.Signature); ok && sig.Recv() != nil && isPointer(sig.Recv().Type()) {
+						markAssigned(n.X)
+					}
+				}
+			case *ast.ReturnStmt:
+				if !inFuncLit() {
+					err = errors.New("the selection contains a return statement")
+				}
+			case *ast.DeferStmt:
+				if !inFuncLit() {
+					err = errors.New("the selection contains a defer statement")
+				}
+			case *ast.LabeledStmt:
+				err = errors.New("the selection contains a label")
+			case *ast.BranchStmt:
+				if !inFuncLit() && !branchTargetInside(n, stack) {
+					err = fmt.Errorf("the selection contains a %s statement that leaves it", n.Tok)
+				}
+			case *ast.BasicLit:
+				if strings.HasPrefix(n.Value, "`") && strings.Contains(n.Value, "\n") {
+					err = errors.New("the selection contains a multi-line raw string")
+				}
+			}
+			stack = append(stack, n)
+			return err == nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The variables declared by the statements and used after them
+	// are results too.
+	var declaredResults []*types.Var
+	isResult := make(map[*types.Var]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Pos() >= end {
+			if v, ok := pkg.Info.Uses[id].(*types.Var); ok && declared[v] && !isResult[v] {
+				isResult[v] = true
+				declaredResults = append(declaredResults, v)
+			}
+		}
+		return true
+	})
+	var assignedResults []*types.Var
+	for _, v := range params {
+		if assigned[v] {
+			assignedResults = append(assignedResults, v)
+		}
+	}
+	results := append(append([]*types.Var{}, assignedResults...), declaredResults...)
+	for _, v := range append(append([]*types.Var{}, params...), results...) {
+		if usesLocalType(pkg.Types, v.Type()) {
+			return nil, fmt.Errorf("the type of %s is local to the function", v.Name())
+		}
+	}
+
+	qf := fileQualifier(f, pkg.Types, pkg.Info)
+	name := freshName(pkg, f, decl.Pos(), "newFunction")
+	var paramList, argList, resultTypes, resultNames []string
+	for _, v := range params {
+		paramList = append(paramList, v.Name()+" "+types.TypeString(v.Type(), qf))
+		argList = append(argList, v.Name())
+	}
+	for _, v := range results {
+		resultTypes = append(resultTypes, types.TypeString(v.Type(), qf))
+		resultNames = append(resultNames, v.Name())
+	}
+
+	// The call replaces the statements. It can declare the results with
+	// := if all the assigned ones are declared in the same block, since
+	// it would declare the others anew.
+	// A function body shares the scope of its parameters, which is why
+	// the scope is looked up by position.
+	scope := pkg.Types.Scope().Innermost(block.Pos())
+	redeclare := true
+	for _, v := range assignedResults {
+		if v.Parent() != scope {
+			redeclare = false
+		}
+	}
+	call := name + "(" + strings.Join(argList, ", ") + ")"
+	switch {
+	case len(results) == 0:
+	case len(declaredResults) == 0:
+		call = strings.Join(resultNames, ", ") + " = " + call
+	case redeclare:
+		call = strings.Join(resultNames, ", ") + " := " + call
+	default:
+		var decls []string
+		for _, v := range declaredResults {
+			decls = append(decls, "var "+v.Name()+" "+types.TypeString(v.Type(), qf))
+		}
+		call = strings.Join(decls, "\n") + "\n" + strings.Join(resultNames, ", ") + " = " + call
+	}
+	indent, atIndent := lineIndent(fset, src, start)
+	callStart := start
+	if atIndent {
+		callStart = lineStartPos(fset, start)
+		call = indent + call
+	} else {
+		indent = ""
+	}
+	call = strings.Replace(call, "\n", "\n"+indent, -1)
+
+	// The new function follows the declaration.
+	tf := fset.File(start)
+	var text strings.Builder
+	for _, line := range strings.SplitAfter(string(src[tf.Offset(callStart):tf.Offset(end)]), "\n") {
+		if strings.TrimSpace(line) == "" {
+			text.WriteString(strings.TrimLeft(line, " \t"))
+			continue
+		}
+		text.WriteString("\t" + strings.TrimPrefix(line, indent))
+	}
+	text.WriteString("\n")
+	if len(results) > 0 {
+		text.WriteString("\treturn " + strings.Join(resultNames, ", ") + "\n")
+	}
+	sig := "(" + strings.Join(paramList, ", ") + ")"
+	switch len(resultTypes) {
+	case 0:
+	case 1:
+		sig += " " + resultTypes[0]
+	default:
+		sig += " (" + strings.Join(resultTypes, ", ") + ")"
+	}
+	newFunc := "\n\nfunc " + name + sig + " {\n" + text.String() + "}"
+
+	declEnd := positionForPos(fset, decl.End())
+	return []lsp.TextEdit{
+		{Range: rangeForPos(fset, callStart, end), NewText: call},
+		{Range: lsp.Range{Start: declEnd, End: declEnd}, NewText: newFunc},
+	}, nil
+}
+
+// assignedVar returns the variable that assigning to e changes, if any.
+func assignedVar(info *types.Info, e ast.Expr) *types.Var {
+	for {
+		switch x := e.(type) {
+		case *ast.ParenExpr:
+			e = x.X
+			continue
+		case *ast.SelectorExpr:
+			// Assigning to a field of a struct variable changes the
+			// variable.
+			if sel := info.Selections[x]; sel != nil && sel.Kind() == types.FieldVal && !isPointer(info.TypeOf(x.X)) {
+				e = x.X
+				continue
+			}
+		case *ast.IndexExpr:
+			if t := info.TypeOf(x.X); t != nil {
+				if _, ok := t.Underlying().(*types.Array); ok {
+					e = x.X
+					continue
+				}
+			}
+		case *ast.Ident:
+			v, _ := info.Uses[x].(*types.Var)
+			return v
+		}
+		return nil
+	}
+}
+
+// isPointer reports whether T is a pointer type.
+func isPointer(T types.Type) bool {
+	if T == nil {
+		return false
+	}
+	_, ok := T.Underlying().(*types.Pointer)
+	return ok
+}
+
+// branchTargetInside reports whether the statement a break or continue
+// statement, whose parents are stack, leaves is on the stack.
+func branchTargetInside(branch *ast.BranchStmt, stack []ast.Node) bool {
+	if branch.Label != nil || (branch.Tok != token.BREAK && branch.Tok != token.CONTINUE) {
+		return false
+	}
+	for _, n := range stack {
+		switch n.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			return true
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			if branch.Tok == token.BREAK {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usesLocalType reports whether T refers to a type declared in a function
+// of pkg, or to a type parameter.
+func usesLocalType(pkg *types.Package, T types.Type) bool {
+	switch T := T.(type) {
+	case *types.Named:
+		if isLocalObject(pkg, T.Obj()) {
+			return true
+		}
+		args := T.TypeArgs()
+		for i := 0; i < args.Len(); i++ {
+			if usesLocalType(pkg, args.At(i)) {
+				return true
+			}
+		}
+	case *types.TypeParam:
+		return true
+	case *types.Pointer:
+		return usesLocalType(pkg, T.Elem())
+	case *types.Slice:
+		return usesLocalType(pkg, T.Elem())
+	case *types.Array:
+		return usesLocalType(pkg, T.Elem())
+	case *types.Chan:
+		return usesLocalType(pkg, T.Elem())
+	case *types.Map:
+		return usesLocalType(pkg, T.Key()) || usesLocalType(pkg, T.Elem())
+	case *types.Signature:
+		return usesLocalType(pkg, T.Params()) || usesLocalType(pkg, T.Results())
+	case *types.Tuple:
+		for i := 0; i < T.Len(); i++ {
+			if usesLocalType(pkg, T.At(i).Type()) {
+				return true
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < T.NumFields(); i++ {
+			if usesLocalType(pkg, T.Field(i).Type()) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package langserver
+
+import (
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+func TestExtract(t *testing.T) {
+	const a = `package a
+
+func F(a, b int) int {
+	if a > 0 && b*2 > 1 {
+		return a + b*2
+	}
+	return 0
+}
+
+func G(n int) int {
+	sum := 0
+	x := 1
+	for i := 0; i < n; i++ {
+		sum += i * x
+	}
+	y := sum * 2
+	return y
+}
+
+func H(s []int) {
+	for _, v := range s {
+		if v > 0 {
+			continue
+		}
+		_ = v
+	}
+}
+
+func I() int {
+	return 1
+}
+`
+	pkgs := map[string]map[string]string{"a": {"a.go": a}}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	// selectionOf returns the positions of the occurrence of sel after
+	// the first occurrence of after.
+	selectionOf := func(after, sel string) (token.Pos, token.Pos) {
+		i := strings.Index(a, after)
+		if i < 0 {
+			t.Fatalf("%q not found", after)
+		}
+		j := strings.Index(a[i:], sel)
+		if j < 0 {
+			t.Fatalf("%q not found after %q", sel, after)
+		}
+		offsetPosition := func(offset int) lsp.Position {
+			lines := strings.Split(a[:offset], "\n")
+			return lsp.Position{Line: len(lines) - 1, Character: len(lines[len(lines)-1])}
+		}
+		r := lsp.Range{Start: offsetPosition(i + j), End: offsetPosition(i + j + len(sel))}
+		start, end, err := selection(pkg, f, []byte(a), r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return start, end
+	}
+
+	tests := []struct {
+		name         string
+		after, sel   string
+		want, errStr string
+	}{
+		{
+			name:  "variable",
+			after: "return a + ", sel: "b*2",
+			want: "\tif a > 0 && b*2 > 1 {\n\t\tx := b*2\n\t\treturn a + x\n\t}",
+		},
+		{
+			name:  "variable in condition",
+			after: "if a > 0 && ", sel: "b*2",
+			errStr: "the selection is conditionally evaluated",
+		},
+		{
+			name:  "variable in return",
+			after: "func I", sel: "1",
+			want: "\tx := 1\n\treturn x\n",
+		},
+		{
+			name:  "function",
+			after: "x := 1", sel: "for i := 0; i < n; i++ {\n\t\tsum += i * x\n\t}\n\ty := sum * 2",
+			want: "\tx := 1\n\tsum, y := newFunction(n, sum, x)\n\treturn y\n}\n\nfunc newFunction(n int, sum int, x int) (int, int) {\n\tfor i := 0; i < n; i++ {\n\t\tsum += i * x\n\t}\n\ty := sum * 2\n\treturn sum, y\n}\n",
+		},
+		{
+			name:  "function with return",
+			after: "func F", sel: "return 0",
+			errStr: "the selection contains a return statement",
+		},
+		{
+			name:  "function with escaping continue",
+			after: "if v > 0 {\n", sel: "continue",
+			errStr: "the selection contains a continue statement that leaves it",
+		},
+	}
+	for _, test := range tests {
+		kind := "variable"
+		extract := func(start, end token.Pos) ([]lsp.TextEdit, error) {
+			return extractVariable(pkg, f, []byte(a), start, end)
+		}
+		if strings.HasPrefix(test.name, "function") {
+			kind = "function"
+			extract = func(start, end token.Pos) ([]lsp.TextEdit, error) {
+				return extractFunction(pkg, f, []byte(a), start, end)
+			}
+		}
+		start, end := selectionOf(test.after, test.sel)
+		edits, err := extract(start, end)
+		if test.errStr != "" {
+			if err == nil || err.Error() != test.errStr {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.errStr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: extracting %s: %v", test.name, kind, err)
+			continue
+		}
+		if got := applyEdits(t, a, edits); !strings.Contains(got, test.want) {
+			t.Errorf("%s: edited source does not contain %q:\n%s", test.name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package langserver
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// fillStruct returns the edits adding the fields missing from the struct
+// literal at pos, keyed by name and with their zero values. Unexported
+// fields of other packages are left out. The packages the zero values refer
+// to are imported if f does not import them yet.
+func fillStruct(pkg *gotype.Package, f *ast.File, src []byte, pos token.Pos) ([]lsp.TextEdit, error) {
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	var lit *ast.CompositeLit
+	for _, n := range path {
+		if n, ok := n.(*ast.CompositeLit); ok && pos > n.Lbrace && pos <= n.Rbrace {
+			lit = n
+			break
+		}
+	}
+	if lit == nil {
+		return nil, errors.New("there is no composite literal at the position")
+	}
+	T := pkg.Info.TypeOf(lit)
+	if ptr, ok := T.(*types.Pointer); ok {
+		T = ptr.Elem() // the elided &T of an element
+	}
+	st, ok := T.Underlying().(*types.Struct)
+	if !ok {
+		return nil, errors.New("the literal is not of a struct type")
+	}
+	present := make(map[string]bool)
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, errors.New("the literal has unkeyed fields")
+		}
+		if key, ok := kv.Key.(*ast.Ident); ok {
+			present[key.Name] = true
+		}
+	}
+
+	fset := pkg.Fset
+	qf, importEdits := importingQualifier(fset, f, pkg.Types, pkg.Info)
+	var names, zeros []string
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if present[field.Name()] || (!field.Exported() && field.Pkg() != pkg.Types) || !hasZeroValue(pkg.Types, field.Type()) {
+			continue
+		}
+		names = append(names, field.Name())
+		zeros = append(zeros, zeroValue(field.Type(), qf))
+	}
+	if len(names) == 0 {
+		return nil, errors.New("the literal has every field")
+	}
+
+	edits := importEdits()
+	tf := fset.File(lit.Pos())
+	if len(lit.Elts) > 0 && tf.Line(lit.Elts[len(lit.Elts)-1].End()) == tf.Line(lit.Rbrace) {
+		// Continue a literal on one line.
+		var text strings.Builder
+		for i, name := range names {
+			text.WriteString(", " + name + ": " + zeros[i])
+		}
+		pos := positionForPos(fset, lit.Elts[len(lit.Elts)-1].End())
+		return append(edits, lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: text.String()}), nil
+	}
+
+	// Add a line for each field, aligning the values like gofmt.
+	indent, _ := lineIndent(fset, src, lit.Pos())
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	var text strings.Builder
+	for i, name := range names {
+		text.WriteString(indent + "\t" + name + ":" + strings.Repeat(" ", width-len(name)+1) + zeros[i] + ",\n")
+	}
+	if len(lit.Elts) > 0 {
+		pos := positionForPos(fset, lineStartPos(fset, lit.Rbrace))
+		return append(edits, lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: text.String()}), nil
+	}
+	return append(edits, lsp.TextEdit{
+		Range:   rangeForPos(fset, lit.Lbrace+1, lit.Rbrace),
+		NewText: "\n" + text.String() + indent,
+	}), nil
+}
+
+// hasZeroValue reports whether the zero value of T can be written in pkg.
+// That of a struct or array type names it, which is impossible for the
+// unexported types of other packages.
+func hasZeroValue(pkg *types.Package, T types.Type) bool {
+	named, ok := T.(*types.Named)
+	if !ok || named.Obj().Exported() || named.Obj().Pkg() == pkg {
+		return true
+	}
+	switch named.Underlying().(type) {
+	case *types.Struct, *types.Array:
+		return false
+	}
+	return true
+}
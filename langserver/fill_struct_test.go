@@ -0,0 +1,117 @@
+package langserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+func TestFillStruct(t *testing.T) {
+	const a = `package a
+
+import b2 "b"
+
+type local struct {
+	n    int
+	Opts b2.Options
+}
+
+func F() {
+	_ = b2.Options{}
+	_ = local{n: 1}
+	_ = []local{
+		{
+			n: 2,
+		},
+	}
+	_ = local{1, b2.Options{}}
+	_ = local{n: 1, Opts: b2.Options{}}
+}
+`
+	const b = `package b
+
+import "bytes"
+
+type Base struct{ ID int }
+
+type secret struct{}
+
+type Options struct {
+	Base
+	*bytes.Reader
+	Name   string
+	Buf    bytes.Buffer
+	Tags   []string
+	hidden int
+	Secret secret
+	Nested struct{ X int }
+}
+`
+	pkgs := map[string]map[string]string{
+		"a":     {"a.go": a},
+		"b":     {"b.go": b},
+		"bytes": {"bytes.go": "package bytes\n\ntype Buffer struct{}\n\ntype Reader struct{}\n"},
+	}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	tests := []struct {
+		at           string // the text the position is at the end of
+		want, errStr string
+	}{
+		{
+			at:   "_ = b2.Options{",
+			want: "import b2 \"b\"\nimport \"bytes\"\n",
+		},
+		{
+			at:   "_ = b2.Options{",
+			want: "\t_ = b2.Options{\n\t\tBase:   b2.Base{},\n\t\tReader: nil,\n\t\tName:   \"\",\n\t\tBuf:    bytes.Buffer{},\n\t\tTags:   nil,\n\t\tNested: struct{X int}{},\n\t}\n",
+		},
+		{
+			at:   "_ = local{n: 1",
+			want: "\t_ = local{n: 1, Opts: b2.Options{}}\n",
+		},
+		{
+			at:   "{\n\t\t\tn",
+			want: "\t\t{\n\t\t\tn: 2,\n\t\t\tOpts: b2.Options{},\n\t\t},\n",
+		},
+		{
+			at:     "_ = local{1",
+			errStr: "the literal has unkeyed fields",
+		},
+		{
+			at:     "_ = local{n: 1, Opts",
+			errStr: "the literal has every field",
+		},
+		{
+			at:     "func F(",
+			errStr: "there is no composite literal at the position",
+		},
+	}
+	for _, test := range tests {
+		i := strings.Index(a, test.at)
+		if i < 0 {
+			t.Fatalf("%q not found", test.at)
+		}
+		lines := strings.Split(a[:i+len(test.at)], "\n")
+		p := lsp.Position{Line: len(lines) - 1, Character: len(lines[len(lines)-1])}
+		pos, err := posForPosition(pkg.Fset.File(f.Pos()), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edits, err := fillStruct(pkg, f, []byte(a), pos)
+		if test.errStr != "" {
+			if err == nil || err.Error() != test.errStr {
+				t.Errorf("at %q: got error %v, want %q", test.at, err, test.errStr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("at %q: %v", test.at, err)
+			continue
+		}
+		if got := applyEdits(t, a, edits); !strings.Contains(got, test.want) {
+			t.Errorf("at %q: filled source does not contain %q:\n%s", test.at, test.want, got)
+		}
+	}
+}
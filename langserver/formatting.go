@@ -0,0 +1,67 @@
+package langserver
+
+import (
+	"context"
+	"go/format"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleFormatting(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.DocumentFormattingParams) ([]lsp.TextEdit, error) {
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return formatEdits(contents)
+}
+
+func (h *LangHandler) handleRangeFormatting(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.DocumentRangeFormattingParams) ([]lsp.TextEdit, error) {
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	edits, err := formatEdits(contents)
+	if err != nil {
+		return nil, err
+	}
+	return editsInRange(edits, params.Range), nil
+}
+
+// formatEdits returns the edits making contents gofmt-clean. The formatting
+// options of the request are ignored: gofmt always indents with tabs.
+func formatEdits(contents []byte) ([]lsp.TextEdit, error) {
+	formatted, err := format.Source(contents)
+	if err != nil {
+		return nil, err
+	}
+	return textEdits(string(contents), string(formatted)), nil
+}
+
+// editsInRange returns the edits, made by textEdits, that touch the lines
+// of r. gofmt may align a line with its neighbours, so formatting a range
+// can leave the lines around it unformatted.
+func editsInRange(edits []lsp.TextEdit, r lsp.Range) []lsp.TextEdit {
+	first, last := r.Start.Line, r.End.Line
+	if r.End.Character == 0 && last > first {
+		// The selection ends at the start of a line, which it
+		// does not include.
+		last--
+	}
+	inRange := []lsp.TextEdit{}
+	for _, e := range edits {
+		start, end := e.Range.Start.Line, e.Range.End.Line
+		if e.Range.End.Character > 0 {
+			// The edit replaces the last line, which has no newline.
+			end++
+		}
+		if start == end {
+			// An insertion before line start touches it.
+			end++
+		}
+		if start <= last && end > first {
+			inRange = append(inRange, e)
+		}
+	}
+	return inRange
+}
@@ -0,0 +1,64 @@
+package langserver
+
+import (
+	"go/format"
+	"reflect"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+func TestTextEdits(t *testing.T) {
+	tests := []struct{ before, after string }{
+		{"", ""},
+		{"a\n", "a\n"},
+		{"", "a\nb\n"},
+		{"a\nb\n", ""},
+		{"a\nb\nc\n", "a\nx\nc\n"},
+		{"a\nb\nc\nd\ne\n", "x\nb\nd\ne\ny\n"},
+		{"a\nb", "a\nb\n"},
+		{"a\nb", "a\nc"},
+		{"a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n"},
+	}
+	for _, test := range tests {
+		edits := textEdits(test.before, test.after)
+		if got := applyEdits(t, test.before, edits); got != test.after {
+			t.Errorf("%q to %q: edits %+v give %q", test.before, test.after, edits, got)
+		}
+	}
+
+	// Only changed lines are replaced.
+	edits := textEdits("a\nb\nc\n", "a\nx\nc\n")
+	want := []lsp.TextEdit{{
+		Range:   lsp.Range{Start: lsp.Position{Line: 1}, End: lsp.Position{Line: 2}},
+		NewText: "x\n",
+	}}
+	if !reflect.DeepEqual(edits, want) {
+		t.Errorf("got %+v, want %+v", edits, want)
+	}
+}
+
+func TestFormatEdits(t *testing.T) {
+	const src = "package a\n\nfunc F()  {\nx:=1\n_ = x\n}\n\nvar ( a = 1\nbb = 2 )"
+	edits, err := formatEdits([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := format.Source([]byte(src))
+	if got := applyEdits(t, src, edits); got != string(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if edits[0].Range.Start.Line != 2 {
+		t.Errorf("unchanged lines are edited: %+v", edits)
+	}
+
+	// Only the edits on the selected lines are kept.
+	inRange := editsInRange(edits, lsp.Range{Start: lsp.Position{Line: 7}, End: lsp.Position{Line: 8, Character: 2}})
+	if got, want := applyEdits(t, src, inRange), "package a\n\nfunc F()  {\nx:=1\n_ = x\n}\n\nvar (\n\ta  = 1\n\tbb = 2\n)\n"; got != want {
+		t.Errorf("range formatting gives %q, want %q", got, want)
+	}
+
+	if _, err := formatEdits([]byte("package a\n\nfunc {")); err == nil {
+		t.Error("no error formatting invalid source")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/opentracing/opentracing-go/ext"
 
 	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/adamfaulkner/go-langserver/pkg/lspext"
 	"github.com/sourcegraph/jsonrpc2"
 )
 
@@ -51,9 +52,14 @@ type LangHandler struct {
 	mu sync.Mutex
 	HandlerCommon
 	*HandlerShared
-	init *InitializeParams // set by "initialize" request
+	init    *InitializeParams     // set by "initialize" request
+	options InitializationOptions // decoded from init
 
-	cancel *cancel
+	cancel   *cancel
+	symbols  *symbolIndex  // lazily built index for workspace/symbol
+	packages *packageIndex // lazily built index of importable packages
+
+	resolvePackages *resolvePackages // packages completion items are resolved against
 
 	adamfMutex              sync.Mutex
 	cancelOngoingOperations func()
@@ -65,6 +71,11 @@ func (h *LangHandler) reset(init *InitializeParams) error {
 		log.Printf("Passing an initialize rootPath URI (%q) is deprecated. Use rootUri instead.", init.InitializeParams.RootPath)
 	}
 
+	options, err := init.options()
+	if err != nil {
+		return fmt.Errorf("invalid initializationOptions: %s", err)
+	}
+
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
@@ -79,7 +90,11 @@ func (h *LangHandler) reset(init *InitializeParams) error {
 		}
 	}
 	h.init = init
+	h.options = options
 	h.cancel = &cancel{}
+	h.symbols = newSymbolIndex()
+	h.packages = newPackageIndex()
+	h.resolvePackages = newResolvePackages()
 	return nil
 }
 
@@ -157,11 +172,60 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 		// TODO(adamf): vscode is sending us garbage when using incremental.
 		// kind := lsp.TDSKIncremental
 		kind := lsp.TDSKFull
+		renameProvider := lsp.RenameOptionsOrBool{Bool: true}
+		if params.Capabilities.TextDocument.Rename.PrepareSupport {
+			renameProvider.Options = &lsp.RenameOptions{PrepareProvider: true}
+		}
+		textDocumentSync := lsp.TextDocumentSyncOptionsOrKind{Kind: &kind}
+		if h.options.FormatOnSave {
+			textDocumentSync = lsp.TextDocumentSyncOptionsOrKind{Options: &lsp.TextDocumentSyncOptions{
+				OpenClose:         true,
+				Change:            kind,
+				WillSaveWaitUntil: true,
+			}}
+		}
+		codeActionProvider := lsp.CodeActionOptionsOrBool{Bool: true}
+		if params.Capabilities.TextDocument.CodeAction.CodeActionLiteralSupport != nil {
+			codeActionProvider.Options = &lsp.CodeActionOptions{CodeActionKinds: codeActionKinds}
+		}
 		return lsp.InitializeResult{
 			Capabilities: lsp.ServerCapabilities{
-				TextDocumentSync: lsp.TextDocumentSyncOptionsOrKind{
-					Kind: &kind,
+				TextDocumentSync: textDocumentSync,
+				HoverProvider:    true,
+				CompletionProvider: &lsp.CompletionOptions{
+					ResolveProvider:   true,
+					TriggerCharacters: []string{"."},
+				},
+				SignatureHelpProvider: &lsp.SignatureHelpOptions{
+					TriggerCharacters: []string{"(", ","},
+				},
+				DefinitionProvider:              true,
+				TypeDefinitionProvider:          true,
+				ImplementationProvider:          true,
+				ReferencesProvider:              true,
+				DocumentHighlightProvider:       true,
+				DocumentSymbolProvider:          true,
+				DocumentFormattingProvider:      true,
+				DocumentRangeFormattingProvider: true,
+				RenameProvider:                  renameProvider,
+				CodeActionProvider:              codeActionProvider,
+				ExecuteCommandProvider: &lsp.ExecuteCommandOptions{
+					Commands: []string{commandRenamePackage, commandMovePackage},
 				},
+				Workspace: &lsp.WorkspaceServerCapabilities{
+					FileOperations: &lsp.FileOperationsServerCapabilities{
+						WillRename: &lsp.FileOperationRegistrationOptions{
+							Filters: []lsp.FileOperationFilter{{
+								Scheme:  "file",
+								Pattern: lsp.FileOperationPattern{Glob: "**", Matches: "folder"},
+							}},
+						},
+					},
+				},
+				WorkspaceSymbolProvider:      true,
+				XDefinitionProvider:          true,
+				XWorkspaceReferencesProvider: true,
+				XWorkspaceSymbolByProperties: true,
 			},
 		}, nil
 
@@ -198,9 +262,242 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 		})
 		return nil, nil
 
+	case "textDocument/hover":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleHover(ctx, conn, req, params)
+
+	case "textDocument/completion":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleCompletion(ctx, conn, req, params)
+
+	case "completionItem/resolve":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.CompletionItem
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleCompletionItemResolve(ctx, conn, req, params)
+
+	case "textDocument/signatureHelp":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleSignatureHelp(ctx, conn, req, params)
+
+	case "textDocument/definition":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleDefinition(ctx, conn, req, params)
+
+	case "textDocument/xdefinition":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleXDefinition(ctx, conn, req, params)
+
+	case "textDocument/typeDefinition":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTypeDefinition(ctx, conn, req, params)
+
+	case "textDocument/implementation":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleImplementation(ctx, conn, req, params)
+
+	case "textDocument/references":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.ReferenceParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleReferences(ctx, conn, req, params)
+
+	case "textDocument/formatting":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.DocumentFormattingParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleFormatting(ctx, conn, req, params)
+
+	case "textDocument/rangeFormatting":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.DocumentRangeFormattingParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleRangeFormatting(ctx, conn, req, params)
+
+	case "textDocument/codeAction":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.CodeActionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleCodeAction(ctx, conn, req, params)
+
+	case "textDocument/willSaveWaitUntil":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.WillSaveTextDocumentParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleWillSaveWaitUntil(ctx, conn, req, params)
+
+	case "textDocument/rename":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.RenameParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleRename(ctx, conn, req, params)
+
+	case "textDocument/prepareRename":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handlePrepareRename(ctx, conn, req, params)
+
+	case "textDocument/documentHighlight":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleDocumentHighlight(ctx, conn, req, params)
+
+	case "textDocument/documentSymbol":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.DocumentSymbolParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleDocumentSymbol(ctx, conn, req, params)
+
+	case "workspace/symbol":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lspext.WorkspaceSymbolParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleWorkspaceSymbol(ctx, conn, req, params)
+
+	case "workspace/xreferences":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lspext.WorkspaceReferencesParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleWorkspaceReferences(ctx, conn, req, params)
+
+	case "workspace/executeCommand":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.ExecuteCommandParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleExecuteCommand(ctx, conn, req, params)
+
+	case "workspace/willRenameFiles":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.RenameFilesParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleWillRenameFiles(ctx, conn, req, params)
+
+	case "workspace/didChangeWatchedFiles":
+		// notification, don't send back results/errors
+		if req.Params == nil {
+			return nil, nil
+		}
+		var params lsp.DidChangeWatchedFilesParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, nil
+		}
+		for _, change := range params.Changes {
+			if isFileURI(change.URI) {
+				h.symbols.invalidate(h.FilePath(change.URI))
+				h.packages.invalidate(h.FilePath(change.URI))
+				h.resolvePackages.invalidate(h.FilePath(change.URI))
+			}
+		}
+		return nil, nil
+
 	default:
 		if isFileSystemRequest(req.Method) {
-			uri, _, err := h.handleFileSystemRequest(ctx, req)
+			uri, changed, err := h.handleFileSystemRequest(ctx, req)
+			if changed && isFileURI(uri) {
+				h.symbols.invalidate(h.FilePath(uri))
+				h.packages.invalidate(h.FilePath(uri))
+				h.resolvePackages.invalidate(h.FilePath(uri))
+			}
 			if uri != "" {
 				go h.adamfDiagnostics(ctx, conn, uri)
 			}
@@ -0,0 +1,129 @@
+package langserver
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+func (h *LangHandler) handleHover(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) (*lsp.Hover, error) {
+	pkg, f, err := h.typecheck(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return hover(pkg, f, params.Position)
+}
+
+// hover describes the object at position p in f. A nil Hover is returned if
+// there is no identifier at p.
+func hover(pkg *gotype.Package, f *ast.File, p lsp.Position) (*lsp.Hover, error) {
+	node, obj, err := objectAtPosition(pkg, f, p)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+
+	contents := []lsp.MarkedString{{Language: "go", Value: objectString(obj, qualifier(pkg.Types))}}
+	if doc := docComment(pkg, obj); doc != "" {
+		contents = append(contents, lsp.RawMarkedString(doc))
+	}
+	if declPkg := declaringPackage(obj); declPkg != nil {
+		contents = append(contents, lsp.RawMarkedString("package "+declPkg.Path()))
+	}
+	r := rangeForNode(pkg.Fset, node)
+	return &lsp.Hover{Contents: contents, Range: &r}, nil
+}
+
+// qualifier formats package-level objects from pkg unqualified, and objects
+// from other packages qualified by their package name.
+func qualifier(pkg *types.Package) types.Qualifier {
+	return func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		return other.Name()
+	}
+}
+
+// objectString returns the Go declaration of obj, e.g. "func Foo(x int)".
+func objectString(obj types.Object, qf types.Qualifier) string {
+	if _, ok := obj.(*types.TypeName); ok {
+		// Show the underlying type rather than repeating the name.
+		return "type " + obj.Name() + " " + types.TypeString(obj.Type().Underlying(), qf)
+	}
+	return types.ObjectString(obj, qf)
+}
+
+// declaringPackage returns the package obj was declared in, or nil for
+// builtin objects. For package names it is the imported package.
+func declaringPackage(obj types.Object) *types.Package {
+	if pkgName, ok := obj.(*types.PkgName); ok {
+		return pkgName.Imported()
+	}
+	return obj.Pkg()
+}
+
+// docComment returns the doc comment of the declaration of obj, which may
+// live in the package itself or in one of its dependencies.
+func docComment(pkg *gotype.Package, obj types.Object) string {
+	if pkgName, ok := obj.(*types.PkgName); ok {
+		for _, f := range pkg.Importer.Files(pkgName.Imported().Path()) {
+			if f.Doc != nil {
+				return strings.TrimSpace(f.Doc.Text())
+			}
+		}
+		return ""
+	}
+	if !obj.Pos().IsValid() {
+		return ""
+	}
+	f := pkg.File(obj.Pos())
+	if f == nil {
+		return ""
+	}
+	path, _ := astutil.PathEnclosingInterval(f, obj.Pos(), obj.Pos())
+	return strings.TrimSpace(declDoc(path).Text())
+}
+
+// declDoc returns the doc comment attached to the innermost declaration in
+// path, falling back to a trailing line comment for fields and specs.
+func declDoc(path []ast.Node) *ast.CommentGroup {
+	for i, n := range path {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			return n.Doc
+		case *ast.Field:
+			if n.Doc != nil {
+				return n.Doc
+			}
+			return n.Comment
+		case *ast.TypeSpec:
+			return specDoc(path[i+1:], n.Doc, n.Comment)
+		case *ast.ValueSpec:
+			return specDoc(path[i+1:], n.Doc, n.Comment)
+		case *ast.FuncLit, *ast.BlockStmt:
+			return nil
+		}
+	}
+	return nil
+}
+
+// specDoc picks the doc comment of a type or value spec. Specs that are not
+// part of a parenthesized group have their doc attached to the GenDecl.
+func specDoc(parents []ast.Node, doc, comment *ast.CommentGroup) *ast.CommentGroup {
+	if doc != nil {
+		return doc
+	}
+	if len(parents) > 0 {
+		if decl, ok := parents[0].(*ast.GenDecl); ok && decl.Lparen == token.NoPos && decl.Doc != nil {
+			return decl.Doc
+		}
+	}
+	return comment
+}
@@ -0,0 +1,89 @@
+package langserver
+
+import (
+	"context"
+	"go/ast"
+	"strings"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/buildutil"
+)
+
+// typecheckFake type-checks the package containing filename in a fake
+// build context (rooted at /go) made up of pkgs.
+func typecheckFake(t *testing.T, pkgs map[string]map[string]string, filename string) (*gotype.Package, *ast.File) {
+	bctx := buildutil.FakeContext(pkgs)
+	bctx.CgoEnabled = true
+	pkg := gotype.Check(context.Background(), filename, bctx)
+	if pkg.Types == nil {
+		t.Fatalf("type-checking %s failed: %v", filename, pkg.Errs)
+	}
+	f := pkg.FileByName(filename)
+	if f == nil {
+		t.Fatalf("%s not found in package %s", filename, pkg.Types.Path())
+	}
+	return pkg, f
+}
+
+// positionOf returns the position of the first occurrence of marker in src.
+func positionOf(t *testing.T, src, marker string) lsp.Position {
+	i := strings.Index(src, marker)
+	if i < 0 {
+		t.Fatalf("marker %q not found", marker)
+	}
+	lines := strings.Split(src[:i], "\n")
+	return lsp.Position{Line: len(lines) - 1, Character: len(lines[len(lines)-1])}
+}
+
+func TestHover(t *testing.T) {
+	const a = `package a
+
+import "b"
+
+// T is a type.
+type T struct {
+	// F is a field.
+	F int
+}
+
+func f() {
+	var t T
+	_ = t.F
+	b.G(1)
+}
+`
+	pkgs := map[string]map[string]string{
+		"a": {"a.go": a},
+		"b": {"b.go": "// Package b is a dependency.\npackage b\n\n// G does things.\nfunc G(x int) string { return \"\" }\n"},
+	}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	tests := []struct {
+		marker string
+		want   []string
+	}{
+		{"T struct", []string{"type T struct{F int}", "T is a type.", "package a"}},
+		{"F int", []string{"field F int", "F is a field.", "package a"}},
+		{"t.F", []string{"var t T", "package a"}},
+		{"G(1)", []string{"func b.G(x int) string", "G does things.", "package b"}},
+		{`"b"`, []string{"package b", "Package b is a dependency.", "package b"}},
+	}
+	for _, test := range tests {
+		h, err := hover(pkg, f, positionOf(t, a, test.marker))
+		if err != nil {
+			t.Fatalf("%q: %v", test.marker, err)
+		}
+		if h == nil {
+			t.Fatalf("%q: no hover", test.marker)
+		}
+		var got []string
+		for _, c := range h.Contents {
+			got = append(got, c.Value)
+		}
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%q: got %q, want %q", test.marker, got, test.want)
+		}
+	}
+}
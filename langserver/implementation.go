@@ -0,0 +1,208 @@
+package langserver
+
+import (
+	"context"
+	"go/ast"
+	"go/build"
+	"go/types"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleImplementation(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) ([]lsp.Location, error) {
+	pkg, f, err := h.typecheck(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return implementation(ctx, h.checkBuildContext(ctx), h.RootFSPath, pkg, f, params.Position)
+}
+
+// implementation returns the locations related to the type or method at
+// position p in f by interface satisfaction. For an interface type that is
+// every type under root implementing it; for a concrete type it is every
+// interface it satisfies, including those of dependencies. For methods the
+// corresponding methods are returned instead. Empty interfaces are ignored,
+// since everything satisfies them.
+func implementation(ctx context.Context, bctx *build.Context, root string, pkg *gotype.Package, f *ast.File, p lsp.Position) ([]lsp.Location, error) {
+	node, obj, err := objectAtPosition(pkg, f, p)
+	if err != nil {
+		return nil, err
+	}
+	if ident, ok := node.(*ast.Ident); ok {
+		if use := pkg.Info.Uses[ident]; use != nil {
+			obj = use
+		}
+	}
+
+	var (
+		T      types.Type
+		method *types.Func
+	)
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		T = obj.Type()
+	case *types.Func:
+		recv := obj.Type().(*types.Signature).Recv()
+		if recv == nil {
+			return []lsp.Location{}, nil
+		}
+		T, method = recv.Type(), obj
+		if ptr, ok := T.(*types.Pointer); ok {
+			T = ptr.Elem()
+		}
+	default:
+		return []lsp.Location{}, nil
+	}
+	if _, ok := T.(*types.Named); !ok {
+		return []lsp.Location{}, nil
+	}
+
+	pkgs, err := workspaceTypes(ctx, bctx, root, pkg)
+	if err != nil {
+		return nil, err
+	}
+	T = canonicalType(pkg, pkgs, T.(*types.Named))
+
+	var (
+		seen = make(map[lsp.Location]bool)
+		locs = []lsp.Location{}
+	)
+	add := func(obj types.Object) {
+		if loc, ok := objectLocation(pkg, obj); ok && !seen[loc] {
+			seen[loc] = true
+			locs = append(locs, loc)
+		}
+	}
+
+	if iface, ok := T.Underlying().(*types.Interface); ok {
+		if iface.Empty() {
+			return locs, nil
+		}
+		for _, C := range namedTypes(pkgs) {
+			if types.IsInterface(C) || !implements(C, iface) {
+				continue
+			}
+			if method == nil {
+				add(C.Obj())
+			} else if m := lookupMethod(types.NewPointer(C), method); m != nil {
+				add(m)
+			}
+		}
+	} else {
+		for _, I := range namedTypes(dependencies(pkgs)) {
+			iface, ok := I.Underlying().(*types.Interface)
+			if !ok || iface.Empty() || !implements(T, iface) {
+				continue
+			}
+			if method == nil {
+				add(I.Obj())
+			} else if m := lookupMethod(I, method); m != nil {
+				add(m)
+			}
+		}
+	}
+	sortLocations(locs)
+	return locs, nil
+}
+
+// workspaceTypes returns the package of pkg along with every package under
+// root, loaded with pkg's importer so that their types can be compared with
+// those of pkg's dependencies. The importer's copy of pkg itself comes
+// second, since the packages importing pkg refer to its types. Packages
+// that do not type-check are included as far as they could be checked.
+func workspaceTypes(ctx context.Context, bctx *build.Context, root string, pkg *gotype.Package) ([]*types.Package, error) {
+	bps, err := workspacePackages(ctx, bctx, root)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := []*types.Package{pkg.Types}
+	self := strings.TrimSuffix(pkg.Types.Path(), "_test")
+	if p, _ := pkg.Importer.Import(self); p != nil {
+		pkgs = append(pkgs, p)
+	}
+	for _, bp := range bps {
+		if bp.ImportPath == self {
+			continue
+		}
+		if p, _ := pkg.Importer.Import(bp.ImportPath); p != nil {
+			pkgs = append(pkgs, p)
+		}
+	}
+	return pkgs, ctx.Err()
+}
+
+// canonicalType returns the copy of T loaded by the importer, if there is
+// one. The package containing the current file is type-checked separately
+// from its copy in the importer, and types from the two are not identical.
+// Types declared only in test files have no copy.
+func canonicalType(pkg *gotype.Package, pkgs []*types.Package, T *types.Named) types.Type {
+	obj := T.Obj()
+	if obj.Pkg() != pkg.Types {
+		return T
+	}
+	path := strings.TrimSuffix(obj.Pkg().Path(), "_test")
+	for _, p := range pkgs[1:] {
+		if p.Path() != path {
+			continue
+		}
+		if c, ok := p.Scope().Lookup(obj.Name()).(*types.TypeName); ok && keyForObject(pkg.Fset, c) == keyForObject(pkg.Fset, obj) {
+			return c.Type()
+		}
+	}
+	return T
+}
+
+// dependencies returns pkgs and all the packages they import, directly or
+// indirectly.
+func dependencies(pkgs []*types.Package) []*types.Package {
+	seen := make(map[*types.Package]bool)
+	var result []*types.Package
+	var visit func(p *types.Package)
+	visit = func(p *types.Package) {
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+		result = append(result, p)
+		for _, imp := range p.Imports() {
+			visit(imp)
+		}
+	}
+	for _, p := range pkgs {
+		visit(p)
+	}
+	return result
+}
+
+// namedTypes returns the package-level named types declared in pkgs.
+func namedTypes(pkgs []*types.Package) []*types.Named {
+	var result []*types.Named
+	for _, p := range pkgs {
+		scope := p.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			if named, ok := tn.Type().(*types.Named); ok {
+				result = append(result, named)
+			}
+		}
+	}
+	return result
+}
+
+// implements reports whether T or *T implements iface.
+func implements(T types.Type, iface *types.Interface) bool {
+	return types.Implements(T, iface) || types.Implements(types.NewPointer(T), iface)
+}
+
+// lookupMethod returns the method of T with the same name as m, or nil.
+func lookupMethod(T types.Type, m *types.Func) *types.Func {
+	obj, _, _ := types.LookupFieldOrMethod(T, false, m.Pkg(), m.Name())
+	fn, _ := obj.(*types.Func)
+	return fn
+}
@@ -0,0 +1,86 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+)
+
+func TestImplementation(t *testing.T) {
+	const a = `package a
+
+type I interface{ M() }
+
+type T struct{}
+
+func (T) M() {}
+
+type Empty interface{}
+
+type S struct{}
+
+type IS interface{ P(S) }
+`
+	pkgs := map[string]map[string]string{
+		"a": {"a.go": a},
+		"b": {"b.go": `package b
+
+import "a"
+
+type U struct{}
+
+func (*U) M() {}
+
+type J interface {
+	M()
+	N(a.T)
+}
+
+type K interface{ M() }
+
+var _ a.I = &U{}
+
+type W struct{}
+
+func (W) P(a.S) {}
+`},
+		"c": {"c.go": "package c\n\ntype V struct{}\n\nfunc (V) N() {}\n"},
+	}
+	bctx := buildutil.FakeContext(pkgs)
+	bctx.CgoEnabled = true
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	tests := []struct {
+		marker string
+		want   []string
+	}{
+		// Interface: all workspace types implementing it.
+		{"I interface", []string{"/a/a.go:4", "/b/b.go:4"}},
+		// Interface method: the methods implementing it.
+		{"M() }", []string{"/a/a.go:6", "/b/b.go:6"}},
+		// Concrete type: the interfaces it satisfies.
+		{"T struct", []string{"/a/a.go:2", "/b/b.go:13"}},
+		// Concrete method: the interface methods it implements.
+		{"M() {}", []string{"/a/a.go:2", "/b/b.go:13"}},
+		{"Empty", nil},
+		// Interface whose methods refer to the types of its package.
+		{"IS interface", []string{"/b/b.go:17"}},
+	}
+	for _, test := range tests {
+		locs, err := implementation(context.Background(), bctx, "/go/src", pkg, f, positionOf(t, a, test.marker))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, loc := range locs {
+			got = append(got, fmt.Sprintf("%s:%d", strings.TrimPrefix(string(loc.URI), "file:///go/src"), loc.Range.Start.Line))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.marker, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package langserver
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+// addImportEdit returns an edit adding an import of importPath, with the
+// given name if it is not "", to f. The import is added to the group of
+// standard library imports or to the last group of other imports, keeping
+// the group sorted. If there is no such group a new one is started, before
+// the other imports for the standard library and after them otherwise.
+func addImportEdit(fset *token.FileSet, f *ast.File, name, importPath string) lsp.TextEdit {
+	spec := strconv.Quote(importPath)
+	if name != "" {
+		spec = name + " " + spec
+	}
+
+	var decl *ast.GenDecl
+	for _, d := range f.Decls {
+		if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			decl = d
+		}
+	}
+	if decl == nil {
+		// Add an import declaration after the package clause.
+		pos := positionForPos(fset, f.Name.End())
+		return lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: "\n\nimport " + spec}
+	}
+	if !decl.Lparen.IsValid() {
+		pos := positionForPos(fset, decl.End())
+		return lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: "\nimport " + spec}
+	}
+	if len(decl.Specs) == 0 {
+		pos := positionForPos(fset, decl.Lparen+1)
+		return lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: "\n\t" + spec + "\n"}
+	}
+
+	std := isStandardImportPath(importPath)
+	var group []ast.Spec
+	for _, g := range importGroups(fset, decl) {
+		if isStandardImportPath(importSpecPath(g[0])) == std && (group == nil || !std) {
+			group = g
+		}
+	}
+	switch {
+	case group == nil && std:
+		pos := lineStart(fset, decl.Specs[0].Pos())
+		return lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: "\t" + spec + "\n\n"}
+	case group == nil:
+		pos := positionForPos(fset, decl.Specs[len(decl.Specs)-1].End())
+		return lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: "\n\n\t" + spec}
+	}
+	for _, s := range group {
+		if importSpecPath(s) > importPath {
+			pos := lineStart(fset, s.Pos())
+			return lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: "\t" + spec + "\n"}
+		}
+	}
+	pos := positionForPos(fset, group[len(group)-1].End())
+	return lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: "\n\t" + spec}
+}
+
+// importGroups splits the specs of a parenthesized import declaration into
+// groups separated by blank lines.
+func importGroups(fset *token.FileSet, decl *ast.GenDecl) [][]ast.Spec {
+	var groups [][]ast.Spec
+	lastLine := -1
+	for _, s := range decl.Specs {
+		line := fset.Position(s.Pos()).Line
+		if len(groups) == 0 || line > lastLine+1 {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], s)
+		lastLine = fset.Position(s.End()).Line
+	}
+	return groups
+}
+
+// importSpecPath returns the unquoted import path of an import spec.
+func importSpecPath(s ast.Spec) string {
+	path, err := strconv.Unquote(s.(*ast.ImportSpec).Path.Value)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// isStandardImportPath reports whether importPath looks like the path of a
+// standard library package, i.e. its first element has no dot.
+func isStandardImportPath(importPath string) bool {
+	first := importPath
+	if i := strings.Index(importPath, "/"); i >= 0 {
+		first = importPath[:i]
+	}
+	return !strings.Contains(first, ".")
+}
+
+// lineStart returns the position of the start of the line containing pos.
+func lineStart(fset *token.FileSet, pos token.Pos) lsp.Position {
+	p := positionForPos(fset, pos)
+	return lsp.Position{Line: p.Line}
+}
+
+// importName returns the name an import of importPath declares in a file,
+// or "" if the import would be unnamed, given the package's actual name.
+func importName(importPath, pkgName string) string {
+	if guessPackageName(importPath) == pkgName {
+		return ""
+	}
+	return pkgName
+}
+
+// guessPackageName guesses the name of the package with the given import
+// path from its last element, ignoring major version suffixes such as "v2"
+// and prefixes and suffixes commonly used in repository names.
+func guessPackageName(importPath string) string {
+	elems := strings.Split(importPath, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i] // gopkg.in/yaml.v2
+	}
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.TrimSuffix(name, "-go")
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return -1
+		}
+		return r
+	}, name)
+}
+
+// isMajorVersion reports whether elem is a major version path element such
+// as "v2".
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+	n, err := strconv.Atoi(elem[1:])
+	return err == nil && n >= 2 && strconv.Itoa(n) == elem[1:]
+}
+
+// fileQualifier is like qualifier, but qualifies objects from packages f
+// imports by the name f imports them under, which may differ from the
+// package's name.
+func fileQualifier(f *ast.File, pkg *types.Package, info *types.Info) types.Qualifier {
+	names := make(map[*types.Package]string)
+	for _, spec := range f.Imports {
+		obj := info.Implicits[spec]
+		if spec.Name != nil {
+			obj = info.Defs[spec.Name]
+		}
+		pkgName, ok := obj.(*types.PkgName)
+		if !ok {
+			continue
+		}
+		if name := pkgName.Name(); name == "." {
+			names[pkgName.Imported()] = "" // dot imports are unqualified
+		} else if name != "_" {
+			names[pkgName.Imported()] = name
+		}
+	}
+	return func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		if name, ok := names[other]; ok {
+			return name
+		}
+		return other.Name()
+	}
+}
+
+// importingQualifier is like fileQualifier, but also returns a function
+// returning the edits importing the packages the qualifier was called for
+// that f does not import yet.
+func importingQualifier(fset *token.FileSet, f *ast.File, pkg *types.Package, info *types.Info) (types.Qualifier, func() []lsp.TextEdit) {
+	imported := map[*types.Package]bool{pkg: true}
+	for _, spec := range f.Imports {
+		if pkgName := importedPkgName(info, spec); pkgName != nil && pkgName.Name() != "_" {
+			imported[pkgName.Imported()] = true
+		}
+	}
+	var missing []*types.Package
+	qf := fileQualifier(f, pkg, info)
+	importing := func(other *types.Package) string {
+		if !imported[other] {
+			imported[other] = true
+			missing = append(missing, other)
+		}
+		return qf(other)
+	}
+	edits := func() []lsp.TextEdit {
+		var edits []lsp.TextEdit
+		for _, p := range missing {
+			edits = append(edits, addImportEdit(fset, f, importName(p.Path(), p.Name()), p.Path()))
+		}
+		return edits
+	}
+	return importing, edits
+}
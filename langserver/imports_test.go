@@ -0,0 +1,90 @@
+package langserver
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+// applyEdits applies non-overlapping edits to src. Positions are byte
+// offsets within lines, like offsetForPosition.
+func applyEdits(t *testing.T, src string, edits []lsp.TextEdit) string {
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		start, ok, why := offsetForPosition([]byte(src), e.Range.Start)
+		if !ok {
+			t.Fatal(why)
+		}
+		end, ok, why := offsetForPosition([]byte(src), e.Range.End)
+		if !ok {
+			t.Fatal(why)
+		}
+		src = src[:start] + e.NewText + src[end:]
+	}
+	return src
+}
+
+func TestAddImportEdit(t *testing.T) {
+	tests := []struct {
+		src, name, path, want string
+	}{
+		{
+			"package a\n",
+			"", "fmt",
+			"package a\n\nimport \"fmt\"\n",
+		},
+		{
+			"package a\n\nimport \"os\"\n",
+			"", "fmt",
+			"package a\n\nimport \"os\"\nimport \"fmt\"\n",
+		},
+		{
+			"package a\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\n\t\"github.com/x/y\"\n)\n",
+			"", "io",
+			"package a\n\nimport (\n\t\"fmt\"\n\t\"io\"\n\t\"os\"\n\n\t\"github.com/x/y\"\n)\n",
+		},
+		{
+			"package a\n\nimport (\n\t\"fmt\"\n\n\t\"github.com/x/y\"\n)\n",
+			"z", "github.com/x/z",
+			"package a\n\nimport (\n\t\"fmt\"\n\n\t\"github.com/x/y\"\n\tz \"github.com/x/z\"\n)\n",
+		},
+		{
+			"package a\n\nimport (\n\t\"github.com/x/y\"\n)\n",
+			"", "strings",
+			"package a\n\nimport (\n\t\"strings\"\n\n\t\"github.com/x/y\"\n)\n",
+		},
+		{
+			"package a\n\nimport (\n\t\"fmt\"\n)\n",
+			"", "github.com/x/y",
+			"package a\n\nimport (\n\t\"fmt\"\n\n\t\"github.com/x/y\"\n)\n",
+		},
+	}
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "a.go", test.src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edit := addImportEdit(fset, f, test.name, test.path)
+		if got := applyEdits(t, test.src, []lsp.TextEdit{edit}); got != test.want {
+			t.Errorf("adding %q to\n%s\ngot:\n%s\nwant:\n%s", test.path, test.src, got, test.want)
+		}
+	}
+}
+
+func TestGuessPackageName(t *testing.T) {
+	tests := map[string]string{
+		"net/http":                    "http",
+		"gopkg.in/yaml.v2":            "yaml",
+		"github.com/go-kit/kit/v2":    "kit",
+		"github.com/mattn/go-sqlite3": "sqlite3",
+		"github.com/x/foo-go":         "foo",
+	}
+	for path, want := range tests {
+		if got := guessPackageName(path); got != want {
+			t.Errorf("%q: got %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,769 @@
+package langserver
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// inlineVariable returns the edits replacing every use of the local
+// variable at pos by the expression initializing it, and removing its
+// declaration. The expression must refer to the same objects, and evaluate
+// to the same value, wherever the variable is used.
+func inlineVariable(pkg *gotype.Package, f *ast.File, src []byte, pos token.Pos) ([]lsp.TextEdit, error) {
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	id, ok := path[0].(*ast.Ident)
+	if !ok {
+		return nil, errors.New("there is no variable at the position")
+	}
+	v, ok := pkg.Info.ObjectOf(id).(*types.Var)
+	if !ok || v.IsField() || !isLocalObject(pkg.Types, v) {
+		return nil, fmt.Errorf("%s is not a local variable", id.Name)
+	}
+	fset := pkg.Fset
+
+	// Find the declaration, which must declare the variable alone.
+	var (
+		decl    ast.Stmt
+		init    ast.Expr
+		parents []ast.Node
+	)
+	declPath, _ := astutil.PathEnclosingInterval(f, v.Pos(), v.Pos())
+	switch n := declPath[1].(type) {
+	case *ast.AssignStmt:
+		if len(n.Lhs) == 1 && len(n.Rhs) == 1 {
+			decl, init, parents = n, n.Rhs[0], declPath[2:]
+		}
+	case *ast.ValueSpec:
+		gen, _ := declPath[2].(*ast.GenDecl)
+		stmt, _ := declPath[3].(*ast.DeclStmt)
+		if len(n.Names) == 1 && len(n.Values) == 1 && gen != nil && len(gen.Specs) == 1 && stmt != nil {
+			decl, init, parents = stmt, n.Values[0], declPath[4:]
+		}
+	}
+	if decl == nil {
+		return nil, fmt.Errorf("%s is not declared alone with an initial value", v.Name())
+	}
+	if !inStmtList(parents) {
+		return nil, fmt.Errorf("%s is declared in the header of a statement", v.Name())
+	}
+
+	root := path[len(path)-2] // the top-level declaration
+	writes := varWrites(pkg.Info, root)
+	if len(writes[v]) > 0 {
+		return nil, fmt.Errorf("%s may change after its declaration", v.Name())
+	}
+	var uses []*ast.Ident
+	ast.Inspect(root, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && pkg.Info.Uses[id] == v {
+			uses = append(uses, id)
+		}
+		return true
+	})
+	if len(uses) == 0 {
+		return nil, fmt.Errorf("%s is never used", v.Name())
+	}
+	for _, use := range uses {
+		if err := checkResolves(pkg, init, use.Pos(), func(types.Object) bool { return false }); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unless the expression evaluates to the same value wherever the
+	// variable is used, it has to be evaluated where it was, i.e. at a
+	// single use in the next statement, before anything else happens.
+	if !invariant(pkg, init, decl.End(), writes) {
+		if len(uses) > 1 && hasIdentity(pkg.Info, init) {
+			return nil, fmt.Errorf("%s is used more than once, and copies of its value would differ", v.Name())
+		}
+		if len(uses) > 1 {
+			return nil, fmt.Errorf("%s is used more than once, and its value may change", v.Name())
+		}
+		usePath, _ := astutil.PathEnclosingInterval(f, uses[0].Pos(), uses[0].End())
+		stmt, err := evaluatingStmt(usePath, "the use of "+v.Name())
+		if err != nil {
+			return nil, err
+		}
+		if stmt != nextStmt(parents[0], decl) || !sideEffectFreeBefore(pkg.Info, stmt, uses[0].Pos()) {
+			return nil, fmt.Errorf("the value of %s may change before its use", v.Name())
+		}
+	}
+
+	qf := fileQualifier(f, pkg.Types, pkg.Info)
+	text := string(src[fset.File(init.Pos()).Offset(init.Pos()):fset.File(init.End()).Offset(init.End())])
+	edits := []lsp.TextEdit{removeEdit(fset, src, decl.Pos(), decl.End())}
+	for _, use := range uses {
+		usePath, _ := astutil.PathEnclosingInterval(f, use.Pos(), use.End())
+		edits = append(edits, lsp.TextEdit{
+			Range:   rangeForNode(fset, use),
+			NewText: replacement(pkg.Info, usePath, init, text, v.Type(), qf),
+		})
+	}
+	return edits, nil
+}
+
+// inlineCall returns the edits replacing the call at pos by the body of the
+// function or method it calls, with the arguments substituted for the
+// parameters. The function must be declared in pkg, and its body must be
+// either a single return statement of one result, or statements returning
+// nothing, for a call that is a statement. The file declaring the function
+// is read through bctx.
+func inlineCall(bctx *build.Context, pkg *gotype.Package, f *ast.File, src []byte, pos token.Pos) ([]lsp.TextEdit, error) {
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	var (
+		id   *ast.Ident
+		call *ast.CallExpr
+		k    = 1 // the index of the call in path
+	)
+	if id, _ = path[0].(*ast.Ident); id != nil {
+		if sel, ok := path[1].(*ast.SelectorExpr); ok && sel.Sel == id {
+			k = 2
+		}
+		if call, _ = path[k].(*ast.CallExpr); call != nil && call.Fun != path[k-1] {
+			call = nil
+		}
+	}
+	fn, ok := pkg.Info.Uses[id].(*types.Func)
+	if call == nil || !ok {
+		return nil, errors.New("there is no function call at the position")
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.TypeParams().Len() > 0 || sig.RecvTypeParams().Len() > 0 {
+		return nil, fmt.Errorf("%s is generic", fn.Name())
+	}
+	if sig.Variadic() {
+		return nil, fmt.Errorf("%s is variadic", fn.Name())
+	}
+	decl, declFile := funcDecl(pkg, fn)
+	if decl == nil || decl.Body == nil {
+		return nil, fmt.Errorf("the body of %s is not in this package", fn.Name())
+	}
+	fset := pkg.Fset
+	declSrc := src
+	if declFile != f {
+		var err error
+		if declSrc, err = readGoFile(bctx, fset.Position(declFile.Pos()).Filename); err != nil {
+			return nil, err
+		}
+	}
+	qf := fileQualifier(f, pkg.Types, pkg.Info)
+
+	// Pair the parameters, including the receiver, with their arguments.
+	var (
+		params []*types.Var
+		args   []ast.Expr
+	)
+	if recv := sig.Recv(); recv != nil {
+		sel, _ := call.Fun.(*ast.SelectorExpr)
+		s := pkg.Info.Selections[sel]
+		if s == nil || s.Kind() != types.MethodVal || len(s.Index()) != 1 || !types.Identical(pkg.Info.TypeOf(sel.X), recv.Type()) {
+			return nil, fmt.Errorf("the receiver of the call is not of type %s", types.TypeString(recv.Type(), qf))
+		}
+		params = append(params, recv)
+		args = append(args, sel.X)
+	}
+	if len(call.Args) != sig.Params().Len() {
+		return nil, errors.New("the arguments of the call are the results of another call")
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		params = append(params, sig.Params().At(i))
+		args = append(args, call.Args[i])
+	}
+
+	// Find what replaces the call: an expression, or statements.
+	var (
+		result ast.Expr
+		stmts  []ast.Stmt
+		stmt   ast.Stmt // the call statement
+	)
+	if sig.Results().Len() > 0 {
+		var ret *ast.ReturnStmt
+		if len(decl.Body.List) == 1 {
+			ret, _ = decl.Body.List[0].(*ast.ReturnStmt)
+		}
+		if sig.Results().Len() > 1 || ret == nil || len(ret.Results) != 1 {
+			return nil, fmt.Errorf("the body of %s is not a single return statement of one result", fn.Name())
+		}
+		if _, ok := path[k+1].(*ast.ExprStmt); ok {
+			return nil, errors.New("the result of the call is unused")
+		}
+		result = ret.Results[0]
+	} else {
+		if s, ok := path[k+1].(*ast.ExprStmt); ok && inStmtList(path[k+2:]) {
+			stmt = s
+		} else {
+			return nil, errors.New("the call is not a statement")
+		}
+		stmts = decl.Body.List
+		if err := checkInlinable(decl.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	// The body must refer to the same objects at the call, and its own
+	// variables must not capture those the arguments refer to.
+	isParam := make(map[types.Object]bool)
+	for _, p := range params {
+		isParam[p] = true
+	}
+	inBody := func(obj types.Object) bool {
+		return obj.Pos() >= decl.Body.Pos() && obj.Pos() < decl.Body.End()
+	}
+	if err := checkResolves(pkg, decl.Body, call.Pos(), func(obj types.Object) bool { return isParam[obj] || inBody(obj) }); err != nil {
+		return nil, err
+	}
+	locals := make(map[string]bool)
+	var paramUses []*ast.Ident
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if obj := pkg.Info.Defs[id]; obj != nil && id.Name != "_" {
+				locals[id.Name] = true
+			}
+			if isParam[pkg.Info.Uses[id]] {
+				paramUses = append(paramUses, id)
+			}
+		}
+		return true
+	})
+	for _, arg := range args {
+		var err error
+		ast.Inspect(arg, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && locals[id.Name] && pkg.Info.Uses[id] != nil && err == nil {
+				err = fmt.Errorf("%s declares %s, which the arguments of the call refer to", fn.Name(), id.Name)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// An argument is evaluated at the uses of its parameter instead of
+	// before the body, so evaluating it there must be the same.
+	writes := varWrites(pkg.Info, decl.Body)
+	callerWrites := varWrites(pkg.Info, path[len(path)-2])
+	pure := result != nil && sideEffectFree([]ast.Expr{result})
+	for i, p := range params {
+		if len(writes[p]) > 0 {
+			return nil, fmt.Errorf("%s changes its parameter %s", fn.Name(), p.Name())
+		}
+		arg := args[i]
+		free := sideEffectFree([]ast.Expr{arg})
+		if free && !hasIdentity(pkg.Info, arg) {
+			// Only the function body could change the value
+			// of the argument.
+			if !pure && !invariant(pkg, arg, anytime, callerWrites) {
+				return nil, fmt.Errorf("%s may change the value of the argument for %s", fn.Name(), p.Name())
+			}
+			continue
+		}
+		// An argument with side effects, or making a new pointer, map
+		// and so on, must be evaluated exactly once, and nothing else
+		// may happen in the meantime.
+		var uses []*ast.Ident
+		for _, id := range paramUses {
+			if pkg.Info.Uses[id] == p {
+				uses = append(uses, id)
+			}
+		}
+		if free && len(uses) != 1 {
+			return nil, fmt.Errorf("the argument for %s would be copied, and the copies would differ", p.Name())
+		}
+		if free && !pure {
+			return nil, fmt.Errorf("the argument for %s must be evaluated before the body of %s", p.Name(), fn.Name())
+		}
+		if !pure || len(uses) != 1 {
+			return nil, fmt.Errorf("the argument for %s has side effects", p.Name())
+		}
+		usePath, _ := astutil.PathEnclosingInterval(declFile, uses[0].Pos(), uses[0].End())
+		if _, err := evaluatingStmt(usePath, "the use of "+p.Name()); err != nil {
+			return nil, err
+		}
+		for j, other := range args {
+			if j != i && pkg.Info.Types[other].Value == nil {
+				return nil, fmt.Errorf("the argument for %s has side effects", p.Name())
+			}
+		}
+	}
+
+	// Substitute the arguments for the parameters in the source of the
+	// body.
+	var start, end token.Pos
+	switch {
+	case result != nil:
+		start, end = result.Pos(), result.End()
+	case len(stmts) > 0:
+		start, end = stmts[0].Pos(), stmts[len(stmts)-1].End()
+	default:
+		return []lsp.TextEdit{removeEdit(fset, src, stmt.Pos(), stmt.End())}, nil
+	}
+	sort.Slice(paramUses, func(i, j int) bool { return paramUses[i].Pos() < paramUses[j].Pos() })
+	tf := fset.File(start)
+	var text strings.Builder
+	offset := tf.Offset(start)
+	for _, id := range paramUses {
+		if id.Pos() < start || id.End() > end {
+			continue
+		}
+		for i, p := range params {
+			if pkg.Info.Uses[id] != p {
+				continue
+			}
+			argSrc := string(src[fset.File(args[i].Pos()).Offset(args[i].Pos()):fset.File(args[i].End()).Offset(args[i].End())])
+			usePath, _ := astutil.PathEnclosingInterval(declFile, id.Pos(), id.End())
+			text.Write(declSrc[offset:tf.Offset(id.Pos())])
+			text.WriteString(replacement(pkg.Info, usePath, args[i], argSrc, p.Type(), qf))
+			offset = tf.Offset(id.End())
+		}
+	}
+	text.Write(declSrc[offset:tf.Offset(end)])
+
+	if result != nil {
+		newText := replacement(pkg.Info, path[k:], result, text.String(), sig.Results().At(0).Type(), qf)
+		return []lsp.TextEdit{{Range: rangeForNode(fset, call), NewText: newText}}, nil
+	}
+
+	// Indent the statements like the call, in a block of their own if
+	// they declare anything.
+	wrap := false
+	for _, s := range stmts {
+		switch s := s.(type) {
+		case *ast.DeclStmt:
+			wrap = true
+		case *ast.AssignStmt:
+			wrap = wrap || s.Tok == token.DEFINE
+		}
+	}
+	bodyIndent, _ := lineIndent(fset, declSrc, stmts[0].Pos())
+	indent, _ := lineIndent(fset, src, stmt.Pos())
+	prefix := indent
+	if wrap {
+		prefix += "\t"
+	}
+	lines := strings.Split(text.String(), "\n")
+	for i, line := range lines {
+		if i > 0 && line != "" {
+			lines[i] = prefix + strings.TrimPrefix(line, bodyIndent)
+		}
+	}
+	newText := strings.Join(lines, "\n")
+	if wrap {
+		newText = "{\n" + prefix + newText + "\n" + indent + "}"
+	}
+	return []lsp.TextEdit{{Range: rangeForNode(fset, stmt), NewText: newText}}, nil
+}
+
+// funcDecl returns the declaration of fn in pkg and the file it is in.
+func funcDecl(pkg *gotype.Package, fn *types.Func) (*ast.FuncDecl, *ast.File) {
+	for _, f := range pkg.Files {
+		for _, decl := range f.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); ok && pkg.Info.Defs[decl.Name] == fn {
+				return decl, f
+			}
+		}
+	}
+	return nil, nil
+}
+
+// checkInlinable checks that the statements of body can replace a call to
+// the function: they must not return from it, defer calls until it
+// returns, or use labels, and they must survive being reindented.
+func checkInlinable(body *ast.BlockStmt) error {
+	var err error
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			err = errors.New("the function returns early")
+		case *ast.DeferStmt:
+			err = errors.New("the function defers a call")
+		case *ast.LabeledStmt:
+			err = errors.New("the function contains a label")
+		case *ast.BasicLit:
+			if strings.HasPrefix(n.Value, "`") && strings.Contains(n.Value, "\n") {
+				err = errors.New("the function contains a multi-line raw string")
+			}
+		}
+		return err == nil
+	})
+	return err
+}
+
+// readGoFile returns the contents of the named file, read through bctx.
+func readGoFile(bctx *build.Context, filename string) ([]byte, error) {
+	rc, err := bctx.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// nextStmt returns the statement following stmt in the statement list of
+// block, or nil.
+func nextStmt(block ast.Node, stmt ast.Stmt) ast.Stmt {
+	var list []ast.Stmt
+	switch block := block.(type) {
+	case *ast.BlockStmt:
+		list = block.List
+	case *ast.CaseClause:
+		list = block.Body
+	case *ast.CommClause:
+		list = block.Body
+	}
+	for i, s := range list {
+		if s == stmt && i+1 < len(list) {
+			return list[i+1]
+		}
+	}
+	return nil
+}
+
+// sideEffectFreeBefore reports whether nothing with side effects is
+// evaluated by stmt before pos.
+func sideEffectFreeBefore(info *types.Info, stmt ast.Stmt, pos token.Pos) bool {
+	free := true
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		if n == nil || n.Pos() >= pos {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			if n.End() <= pos && !info.Types[n.Fun].IsType() {
+				free = false
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.ARROW && n.End() <= pos {
+				free = false
+			}
+		}
+		return free
+	})
+	return free
+}
+
+// anytime is the position of the changes to a variable that may happen at
+// any time.
+const anytime = token.Pos(math.MaxInt32)
+
+// varWrites returns the positions at which the variables in root may be
+// changed: where they are assigned, and where their address is taken or a
+// method with a pointer receiver is called on them. Changes in function
+// literals, and through pointers, may happen whenever the literal is called
+// or the pointer used, so they are at anytime.
+func varWrites(info *types.Info, root ast.Node) map[*types.Var][]token.Pos {
+	writes := make(map[*types.Var][]token.Pos)
+	var visit func(n ast.Node, inFuncLit bool)
+	visit = func(n ast.Node, inFuncLit bool) {
+		ast.Inspect(n, func(n ast.Node) bool {
+			var written []ast.Expr
+			indirect := inFuncLit
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				if !inFuncLit {
+					visit(n.Body, true)
+					return false
+				}
+			case *ast.AssignStmt:
+				written = n.Lhs
+			case *ast.IncDecStmt:
+				written = []ast.Expr{n.X}
+			case *ast.RangeStmt:
+				if n.Tok == token.ASSIGN {
+					written = []ast.Expr{n.Key, n.Value}
+				}
+			case *ast.UnaryExpr:
+				if n.Op == token.AND {
+					written, indirect = []ast.Expr{n.X}, true
+				}
+			case *ast.SelectorExpr:
+				if sel := info.Selections[n]; sel != nil && sel.Kind() == types.MethodVal && !isPointer(info.TypeOf(n.X)) {
+					if sig, ok := sel.Obj().Type().(*types.Signature); ok && sig.Recv() != nil && isPointer(sig.Recv().Type()) {
+						written, indirect = []ast.Expr{n.X}, true
+					}
+				}
+			}
+			for _, e := range written {
+				if e == nil {
+					continue
+				}
+				if v := assignedVar(info, e); v != nil {
+					pos := e.Pos()
+					if indirect {
+						pos = anytime
+					}
+					writes[v] = append(writes[v], pos)
+				}
+			}
+			return true
+		})
+	}
+	visit(root, false)
+	return writes
+}
+
+// invariant reports whether evaluating e gives the same value anywhere from
+// pos on, given the writes to the variables of the function it is in.
+func invariant(pkg *gotype.Package, e ast.Expr, pos token.Pos, writes map[*types.Var][]token.Pos) bool {
+	if !sideEffectFree([]ast.Expr{e}) || hasIdentity(pkg.Info, e) {
+		return false
+	}
+	ok := true
+	ast.Inspect(e, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.SelectorExpr:
+			if sel := pkg.Info.Selections[n]; sel != nil && sel.Indirect() {
+				ok = false // the pointer may be written through
+			}
+		case *ast.Ident:
+			if v, isVar := pkg.Info.Uses[n].(*types.Var); isVar && !v.IsField() {
+				if !isLocalObject(pkg.Types, v) {
+					ok = false // any call may change a package variable
+				}
+				for _, w := range writes[v] {
+					if w >= pos {
+						ok = false
+					}
+				}
+			}
+		}
+		return ok
+	})
+	return ok
+}
+
+// hasIdentity reports whether evaluating e again may give a different
+// pointer, map, slice, channel or function, one writes through the first
+// would not be seen through: e has a composite literal, function literal or
+// address, or has such a type and is not simply a variable.
+func hasIdentity(info *types.Info, e ast.Expr) bool {
+	if _, ok := astutil.Unparen(e).(*ast.Ident); ok {
+		return false
+	}
+	found := false
+	ast.Inspect(e, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CompositeLit, *ast.FuncLit:
+			found = true
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				found = true
+			}
+		}
+		return !found
+	})
+	if found {
+		return true
+	}
+	if T := info.TypeOf(e); T != nil {
+		switch T.Underlying().(type) {
+		case *types.Pointer, *types.Map, *types.Slice, *types.Chan, *types.Signature:
+			return true
+		}
+	}
+	return false
+}
+
+// checkResolves checks that the identifiers in n refer to the same objects
+// at pos, except for those referring to objects local reports true for.
+// Identifiers that are not looked up in scopes, like field and method
+// names, are skipped.
+func checkResolves(pkg *gotype.Package, n ast.Node, pos token.Pos, local func(types.Object) bool) error {
+	scope := pkg.Types.Scope().Innermost(pos)
+	if scope == nil {
+		scope = pkg.Types.Scope()
+	}
+	var err error
+	ast.Inspect(n, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || err != nil {
+			return err == nil
+		}
+		obj := pkg.Info.Uses[id]
+		if obj == nil || obj.Parent() == nil || (obj.Pkg() != nil && obj.Pkg() != pkg.Types) || local(obj) {
+			return true
+		}
+		_, found := scope.LookupParent(id.Name, pos)
+		if found == obj {
+			return true
+		}
+		// Files may import a package under the same name.
+		if pkgName, ok := obj.(*types.PkgName); ok {
+			if other, ok := found.(*types.PkgName); ok && other.Imported() == pkgName.Imported() {
+				return true
+			}
+		}
+		err = fmt.Errorf("%s refers to something else at line %d", id.Name, pkg.Fset.Position(pos).Line)
+		return false
+	})
+	return err
+}
+
+// replacement returns the source text replacing the expression path[0] by
+// the expression e, whose source is text, converted to T if e would
+// otherwise have another type, and parenthesized if needed.
+func replacement(info *types.Info, path []ast.Node, e ast.Expr, text string, T types.Type, qf types.Qualifier) string {
+	// The type recorded for an untyped constant is the one it is
+	// converted to.
+	t := info.TypeOf(e)
+	if kind, ok := untypedKind(info, e); ok {
+		t = types.Typ[kind]
+	}
+	if t != nil && !types.Identical(t, T) && !(isUntyped(t) && types.Identical(types.Default(t), T)) {
+		typ := types.TypeString(T, qf)
+		if strings.HasPrefix(typ, "*") || strings.HasPrefix(typ, "<-") || strings.HasPrefix(typ, "func") {
+			typ = "(" + typ + ")"
+		}
+		return typ + "(" + text + ")"
+	}
+	if needsParens(path, e) {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// isUntyped reports whether T is the type of an untyped constant or nil.
+func isUntyped(T types.Type) bool {
+	b, ok := T.(*types.Basic)
+	return ok && b.Info()&types.IsUntyped != 0
+}
+
+// untypedKind returns the kind of e if it is untyped: nil, or a constant
+// expression of literals and untyped constants.
+func untypedKind(info *types.Info, e ast.Expr) (types.BasicKind, bool) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.INT:
+			return types.UntypedInt, true
+		case token.CHAR:
+			return types.UntypedRune, true
+		case token.FLOAT:
+			return types.UntypedFloat, true
+		case token.IMAG:
+			return types.UntypedComplex, true
+		case token.STRING:
+			return types.UntypedString, true
+		}
+	case *ast.Ident:
+		switch obj := info.Uses[e].(type) {
+		case *types.Nil:
+			return types.UntypedNil, true
+		case *types.Const:
+			if b, ok := obj.Type().(*types.Basic); ok && b.Info()&types.IsUntyped != 0 {
+				return b.Kind(), true
+			}
+		}
+	case *ast.ParenExpr:
+		return untypedKind(info, e.X)
+	case *ast.UnaryExpr:
+		return untypedKind(info, e.X)
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return types.UntypedBool, info.Types[e].Value != nil
+		case token.SHL, token.SHR:
+			if info.Types[e].Value == nil {
+				return 0, false
+			}
+			return untypedKind(info, e.X)
+		}
+		x, ok := untypedKind(info, e.X)
+		y, ok2 := untypedKind(info, e.Y)
+		if !ok || !ok2 {
+			return 0, false
+		}
+		// The kind that comes later in the list of untyped
+		// numeric kinds wins.
+		if y > x {
+			return y, true
+		}
+		return x, true
+	}
+	return 0, false
+}
+
+// needsParens reports whether the expression e needs parentheses to replace
+// the expression path[0].
+func needsParens(path []ast.Node, e ast.Expr) bool {
+	prec := token.HighestPrec // operands and primary expressions
+	switch e := e.(type) {
+	case *ast.BinaryExpr:
+		prec = e.Op.Precedence()
+	case *ast.UnaryExpr, *ast.StarExpr:
+		prec = token.UnaryPrec
+	}
+	switch parent := path[1].(type) {
+	case *ast.BinaryExpr:
+		if prec < parent.Op.Precedence() || (prec == parent.Op.Precedence() && path[0] == parent.Y) {
+			return true
+		}
+	case *ast.UnaryExpr, *ast.StarExpr:
+		// Parenthesizing unary operands avoids --x and the like.
+		if prec <= token.UnaryPrec {
+			return true
+		}
+	case *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr, *ast.SliceExpr, *ast.TypeAssertExpr:
+		if prec <= token.UnaryPrec && path[0].Pos() == parent.Pos() {
+			return true
+		}
+	case *ast.CallExpr:
+		if prec <= token.UnaryPrec && path[0] == parent.Fun {
+			return true
+		}
+	}
+
+	// A composite literal in the header of a statement is taken for its
+	// block unless it is enclosed in parentheses, brackets or braces.
+	hasLit := false
+	ast.Inspect(e, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.CompositeLit); ok && lit.Type != nil {
+			hasLit = true
+		}
+		return !hasLit
+	})
+	if !hasLit {
+		return false
+	}
+	child := path[0]
+	for _, n := range path[1:] {
+		switch n := n.(type) {
+		case *ast.ParenExpr, *ast.CompositeLit, *ast.IndexExpr, *ast.IndexListExpr, *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			if child != n.Fun {
+				return false
+			}
+		case *ast.IfStmt:
+			return child != n.Body && child != n.Else
+		case *ast.ForStmt:
+			return child != n.Body
+		case *ast.RangeStmt:
+			return child != n.Body
+		case *ast.SwitchStmt:
+			return child != n.Body
+		case *ast.TypeSwitchStmt:
+			return child != n.Body
+		case ast.Stmt:
+			return false
+		}
+		child = n
+	}
+	return false
+}
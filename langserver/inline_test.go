@@ -0,0 +1,184 @@
+package langserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/buildutil"
+)
+
+func TestInline(t *testing.T) {
+	const a = `package a
+
+func g() int { return 1 }
+
+func V1(a, b int) int {
+	x := a + b
+	return x * 2
+}
+
+func V2(n int) int {
+	y := n
+	for n := 0; n < 3; n++ {
+		_ = y
+	}
+	return 0
+}
+
+func V3() int {
+	z := g()
+	a := 1
+	return z + a
+}
+
+func V4() int {
+	w := g()
+	return w + 1
+}
+
+func V5() int {
+	c := 1
+	c++
+	return c
+}
+
+func V6() float64 {
+	var f float64 = 1
+	return f / 2
+}
+
+func V7() int {
+	p := &counter{}
+	p.n = 1
+	return p.n
+}
+
+func V8() int {
+	m := map[string]int{}
+	m["a"] = 1
+	return m["a"]
+}
+
+func V9() int {
+	q := &counter{n: 1}
+	return q.n
+}
+
+func C1(a int) int {
+	return double(a + 1)
+}
+
+func C2() float64 {
+	return half(1)
+}
+
+func C3() {
+	c := &counter{}
+	c.add(2)
+}
+
+func C4() int {
+	return double(g()) + sq(g())
+}
+
+func C5(t string) {
+	show(t)
+	show("x")
+}
+
+func C6() int {
+	return size(map[string]int{})
+}
+
+func C7() int {
+	return count(&counter{n: 2})
+}
+`
+	const b = `package a
+
+type counter struct{ n, calls int }
+
+func (c *counter) add(n int) {
+	c.n += n
+	c.calls++
+}
+
+func double(n int) int { return n * 2 }
+
+func half(x float64) float64 { return x / 2 }
+
+func sq(n int) int { return n * n }
+
+func size(m map[string]int) int {
+	return len(m) + len(m)
+}
+
+func count(c *counter) int { return c.n }
+
+func show(s string) {
+	t := s + "!"
+	println(t)
+}
+`
+	pkgs := map[string]map[string]string{"a": {"a.go": a, "b.go": b}}
+	bctx := buildutil.FakeContext(pkgs)
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	tests := []struct {
+		after, at    string
+		want, errStr string
+	}{
+		{after: "func V1", at: "x :=", want: "func V1(a, b int) int {\n\treturn (a + b) * 2\n}"},
+		{after: "func V2", at: "y :=", errStr: "n refers to something else at line 13"},
+		{after: "func V3", at: "z :=", errStr: "the value of z may change before its use"},
+		{after: "func V4", at: "w + 1", want: "func V4() int {\n\treturn g() + 1\n}"},
+		{after: "func V5", at: "c :=", errStr: "c may change after its declaration"},
+		{after: "func V6", at: "f / 2", want: "\treturn float64(1) / 2\n"},
+		{after: "func V7", at: "p :=", errStr: "p is used more than once, and copies of its value would differ"},
+		{after: "func V8", at: "m :=", errStr: "m is used more than once, and copies of its value would differ"},
+		{after: "func V9", at: "q :=", want: "func V9() int {\n\treturn (&counter{n: 1}).n\n}"},
+		{after: "func C1", at: "double", want: "\treturn (a + 1) * 2\n"},
+		{after: "func C2", at: "half", want: "\treturn float64(1) / 2\n"},
+		{after: "func C3", at: "add", want: "\tc := &counter{}\n\tc.n += 2\n\tc.calls++\n}"},
+		{after: "func C4", at: "double", want: "\treturn g() * 2 + sq(g())\n"},
+		{after: "func C4", at: "sq", errStr: "the argument for n has side effects"},
+		{after: "func C5", at: "show(t)", errStr: "show declares t, which the arguments of the call refer to"},
+		{after: "func C6", at: "size", errStr: "the argument for m would be copied, and the copies would differ"},
+		{after: "func C7", at: "count", want: "\treturn (&counter{n: 2}).n\n"},
+		{after: "func C5", at: `show("x")`, want: "\t{\n\t\tt := \"x\" + \"!\"\n\t\tprintln(t)\n\t}\n}"},
+	}
+	for _, test := range tests {
+		i := strings.Index(a, test.after)
+		j := strings.Index(a[i:], test.at)
+		if i < 0 || j < 0 {
+			t.Fatalf("%q not found after %q", test.at, test.after)
+		}
+		lines := strings.Split(a[:i+j], "\n")
+		p := lsp.Position{Line: len(lines) - 1, Character: len(lines[len(lines)-1])}
+		pos, err := posForPosition(pkg.Fset.File(f.Pos()), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var edits []lsp.TextEdit
+		if strings.HasPrefix(test.after, "func V") {
+			edits, err = inlineVariable(pkg, f, []byte(a), pos)
+		} else {
+			edits, err = inlineCall(bctx, pkg, f, []byte(a), pos)
+		}
+		if test.errStr != "" {
+			if err == nil || err.Error() != test.errStr {
+				t.Errorf("%s at %q: got error %v, want %q", test.after, test.at, err, test.errStr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s at %q: %v", test.after, test.at, err)
+			continue
+		}
+		if got := applyEdits(t, a, edits); !strings.Contains(got, test.want) {
+			t.Errorf("%s at %q: edited source does not contain %q:\n%s", test.after, test.at, test.want, got)
+		}
+	}
+}
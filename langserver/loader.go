@@ -2,6 +2,9 @@ package langserver
 
 import (
 	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
 	"log"
 	"os"
 	"runtime/pprof"
@@ -81,3 +84,34 @@ func (h *LangHandler) adamfDiagnostics(ctx context.Context, conn jsonrpc2.JSONRP
 		log.Printf("warning: failed to send diagnostics: %s.", err)
 	}
 }
+
+// typecheck type-checks the package containing fileURI, including any
+// unsaved changes in the overlay, and returns it along with the syntax tree
+// of the file.
+func (h *LangHandler) typecheck(ctx context.Context, fileURI lsp.DocumentURI) (*gotype.Package, *ast.File, error) {
+	if !isFileURI(fileURI) {
+		return nil, nil, fmt.Errorf("invalid file URI %q", fileURI)
+	}
+	filename := h.FilePath(fileURI)
+
+	pkg := gotype.Check(ctx, filename, h.checkBuildContext(ctx))
+	if pkg.Types == nil {
+		if len(pkg.Errs) > 0 {
+			return nil, nil, pkg.Errs[0]
+		}
+		return nil, nil, fmt.Errorf("unable to type-check %s", filename)
+	}
+	f := pkg.FileByName(filename)
+	if f == nil {
+		return nil, nil, fmt.Errorf("%s is not part of package %s", filename, pkg.Types.Path())
+	}
+	return pkg, f, nil
+}
+
+// checkBuildContext returns the build context used for type-checking.
+func (h *LangHandler) checkBuildContext(ctx context.Context) *build.Context {
+	bctx := h.BuildContext(ctx)
+	// cgo is not supported.
+	bctx.CgoEnabled = true
+	return bctx
+}
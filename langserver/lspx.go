@@ -1,6 +1,10 @@
 package langserver
 
-import "github.com/adamfaulkner/go-langserver/pkg/lsp"
+import (
+	"encoding/json"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
 
 // This file contains Go-specific extensions to LSP types.
 //
@@ -27,6 +31,35 @@ type InitializeParams struct {
 	RootImportPath string
 }
 
+// options decodes the initializationOptions of the request.
+func (p *InitializeParams) options() (InitializationOptions, error) {
+	var options InitializationOptions
+	if p.InitializationOptions == nil {
+		return options, nil
+	}
+	data, err := json.Marshal(p.InitializationOptions)
+	if err != nil {
+		return options, err
+	}
+	err = json.Unmarshal(data, &options)
+	return options, err
+}
+
+// InitializationOptions are the Go-specific settings a client may pass in
+// the initializationOptions field of the initialize request. Unlike the
+// fields of InitializeParams, any client can send them.
+type InitializationOptions struct {
+	// LocalImportPrefix is a comma-separated list of import path
+	// prefixes. Organizing imports groups the imports of matching
+	// packages after the third-party ones, like goimports -local.
+	LocalImportPrefix string `json:"localImportPrefix,omitempty"`
+
+	// FormatOnSave makes the server format documents and organize
+	// their imports before they are saved, in response to
+	// textDocument/willSaveWaitUntil.
+	FormatOnSave bool `json:"formatOnSave,omitempty"`
+}
+
 type InitializeBuildContextParams struct {
 	// These fields correspond to the fields of the same name from
 	// go/build.Context.
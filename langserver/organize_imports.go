@@ -0,0 +1,291 @@
+package langserver
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// handleWillSaveWaitUntil formats the document and organizes its imports
+// before it is saved, if the client asked for it with the formatOnSave
+// option.
+func (h *LangHandler) handleWillSaveWaitUntil(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.WillSaveTextDocumentParams) ([]lsp.TextEdit, error) {
+	if !h.options.FormatOnSave {
+		return []lsp.TextEdit{}, nil
+	}
+	edits, err := h.organizeImports(ctx, params.TextDocument.URI)
+	if err == nil {
+		return edits, nil
+	}
+	// The package may not type-check, but the file can still be
+	// formatted.
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	edits, err = formatEdits(contents)
+	if err != nil {
+		// Saving a file with syntax errors must not fail.
+		return []lsp.TextEdit{}, nil
+	}
+	return edits, nil
+}
+
+// organizeImports returns the edits organizing the imports of the document
+// uri, as it is in the overlay.
+func (h *LangHandler) organizeImports(ctx context.Context, uri lsp.DocumentURI) ([]lsp.TextEdit, error) {
+	pkg, f, err := h.typecheck(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := h.readFile(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	return organizeImports(ctx, h.checkBuildContext(ctx), h.packages, h.options.LocalImportPrefix, pkg, f, contents)
+}
+
+// importRef is an import of a package by path, under name if it is not "".
+type importRef struct {
+	name, path string
+}
+
+// organizeImports returns the edits organizing the imports of f, whose
+// source is contents, the way goimports does: unused imports are removed,
+// the packages providing unresolved selectors are imported, and the
+// imports are grouped into standard library, third-party and local
+// packages, those whose import paths start with one of the comma-separated
+// localPrefix. Like goimports, it gofmts the file too.
+func organizeImports(ctx context.Context, bctx *build.Context, packages *packageIndex, localPrefix string, pkg *gotype.Package, f *ast.File, contents []byte) ([]lsp.TextEdit, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, pkg.Fset.Position(f.Pos()).Filename, contents, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, imp := range unusedImports(pkg, f) {
+		astutil.DeleteNamedImport(fset, file, imp.name, imp.path)
+	}
+	for _, imp := range missingImports(ctx, bctx, packages, pkg, f) {
+		astutil.AddNamedImport(fset, file, imp.name, imp.path)
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	grouped, err := groupImports(buf.Bytes(), localPrefix)
+	if err != nil {
+		return nil, err
+	}
+	formatted, err := format.Source(grouped)
+	if err != nil {
+		return nil, err
+	}
+	return textEdits(string(contents), string(formatted)), nil
+}
+
+// unusedImports returns the imports of f that are never referred to. Blank
+// and dot imports and imports of "C" are kept.
+func unusedImports(pkg *gotype.Package, f *ast.File) []importRef {
+	used := make(map[*types.PkgName]bool)
+	for _, obj := range pkg.Info.Uses {
+		if pkgName, ok := obj.(*types.PkgName); ok {
+			used[pkgName] = true
+		}
+	}
+	var unused []importRef
+	for _, spec := range f.Imports {
+		imp := importRef{path: importSpecPath(spec)}
+		obj := pkg.Info.Implicits[spec]
+		if spec.Name != nil {
+			imp.name = spec.Name.Name
+			obj = pkg.Info.Defs[spec.Name]
+		}
+		if imp.path == "C" || imp.name == "_" || imp.name == "." {
+			continue
+		}
+		if pkgName, ok := obj.(*types.PkgName); ok && !used[pkgName] {
+			unused = append(unused, imp)
+		}
+	}
+	return unused
+}
+
+// missingImports returns the imports providing the unresolved operands of
+// selectors in f.
+func missingImports(ctx context.Context, bctx *build.Context, packages *packageIndex, pkg *gotype.Package, f *ast.File) []importRef {
+	selected := unresolvedSelections(pkg, f)
+	names := make([]string, 0, len(selected))
+	for name := range selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var missing []importRef
+	for _, name := range names {
+		if imp, ok := findImport(ctx, bctx, packages, pkg, name, selected[name]); ok {
+			missing = append(missing, imp)
+		}
+	}
+	return missing
+}
+
+// unresolvedSelections returns the members selected from each unresolved
+// identifier in f, by name.
+func unresolvedSelections(pkg *gotype.Package, f *ast.File) map[string]map[string]bool {
+	selected := make(map[string]map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || x.Name == "_" || pkg.Info.Uses[x] != nil || pkg.Info.Defs[x] != nil {
+			return true
+		}
+		if selected[x.Name] == nil {
+			selected[x.Name] = make(map[string]bool)
+		}
+		selected[x.Name][sel.Sel.Name] = true
+		return true
+	})
+	return selected
+}
+
+// findImport returns the import of the most likely package named name,
+// among those pkg may import, that exports all the given members.
+func findImport(ctx context.Context, bctx *build.Context, packages *packageIndex, pkg *gotype.Package, name string, members map[string]bool) (importRef, bool) {
+	fromPath := strings.TrimSuffix(pkg.Types.Path(), "_test")
+	for _, decls := range packages.lookup(ctx, bctx, fromPath, name) {
+		if exportsAll(decls, members) {
+			return importRef{name: importName(decls.importPath, decls.name), path: decls.importPath}, true
+		}
+	}
+	return importRef{}, false
+}
+
+// exportsAll reports whether decls declares all the given members.
+func exportsAll(decls *packageDecls, members map[string]bool) bool {
+	declared := make(map[string]bool, len(decls.syms))
+	for _, sym := range decls.syms {
+		declared[sym.name] = true
+	}
+	for member := range members {
+		if !declared[member] {
+			return false
+		}
+	}
+	return true
+}
+
+// importGroup returns the group of an import of importPath: the standard
+// library first, then third-party packages, then local ones.
+func importGroup(localPrefix, importPath string) int {
+	for _, prefix := range strings.Split(localPrefix, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" && strings.HasPrefix(importPath, prefix) {
+			return 2
+		}
+	}
+	if isStandardImportPath(importPath) {
+		return 0
+	}
+	return 1
+}
+
+// groupImports splits each run of imports in the gofmt'd source src, that
+// is each block of consecutive import lines, into its import groups,
+// separated by blank lines. An import spec's doc comment moves with it.
+// Import declarations with comments of their own are left alone.
+func groupImports(src []byte, localPrefix string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitLines(string(src))
+	line := func(pos token.Pos) int { return fset.Position(pos).Line - 1 }
+
+	// Rewrite the declarations from last to first so that the line
+	// numbers of the earlier ones stay valid.
+	for i := len(f.Decls) - 1; i >= 0; i-- {
+		decl, ok := f.Decls[i].(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT || !decl.Lparen.IsValid() || len(decl.Specs) == 0 {
+			continue
+		}
+		type chunk struct {
+			group int
+			path  string
+			lines []string
+		}
+		var (
+			runs    [][]chunk
+			covered = line(decl.Lparen) // last line accounted for
+			regular = true
+		)
+		for _, s := range decl.Specs {
+			spec := s.(*ast.ImportSpec)
+			start := line(spec.Pos())
+			if spec.Doc != nil {
+				start = line(spec.Doc.Pos())
+			}
+			end := line(spec.End())
+			if start <= covered {
+				regular = false // specs sharing a line
+				break
+			}
+			for _, l := range lines[covered+1 : start] {
+				if strings.TrimSpace(l) != "" {
+					regular = false // a comment attached to no spec
+				}
+			}
+			if len(runs) == 0 || start > covered+1 {
+				runs = append(runs, nil)
+			}
+			c := chunk{group: importGroup(localPrefix, importSpecPath(spec)), path: importSpecPath(spec), lines: lines[start : end+1]}
+			runs[len(runs)-1] = append(runs[len(runs)-1], c)
+			covered = end
+		}
+		for _, l := range lines[covered+1 : line(decl.Rparen)] {
+			if strings.TrimSpace(l) != "" {
+				regular = false
+			}
+		}
+		if !regular {
+			continue
+		}
+
+		var block []string
+		for i, run := range runs {
+			if i > 0 {
+				block = append(block, "\n")
+			}
+			sort.SliceStable(run, func(i, j int) bool {
+				if run[i].group != run[j].group {
+					return run[i].group < run[j].group
+				}
+				return run[i].path < run[j].path
+			})
+			for j, c := range run {
+				if j > 0 && c.group != run[j-1].group {
+					block = append(block, "\n")
+				}
+				block = append(block, c.lines...)
+			}
+		}
+		first, last := line(decl.Lparen)+1, line(decl.Rparen)
+		lines = append(lines[:first], append(block, lines[last:]...)...)
+	}
+	return []byte(strings.Join(lines, "")), nil
+}
@@ -0,0 +1,184 @@
+package langserver
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+	"golang.org/x/tools/go/buildutil"
+)
+
+func TestOrganizeImports(t *testing.T) {
+	const a = `package a
+
+import (
+	"b"
+	"os"
+	// strings has a doc comment.
+	"strings"
+)
+
+func F() {
+	fmt.Println(os.Args, strings.ToUpper(""))
+	c.C()
+}
+`
+	pkgs := map[string]map[string]string{
+		"a":       {"a.go": a},
+		"b":       {"b.go": "package b\n"},
+		"d/c":     {"c.go": "package c\n\nfunc D() {}\n"},
+		"e/c":     {"c.go": "package c\n\nfunc C() {}\n"},
+		"fmt":     {"fmt.go": "package fmt\n\nfunc Println(a ...interface{}) {}\n"},
+		"os":      {"os.go": "package os\n\nvar Args []string\n"},
+		"strings": {"strings.go": "package strings\n\nfunc ToUpper(s string) string { return s }\n"},
+	}
+	bctx := buildutil.FakeContext(pkgs)
+	bctx.CgoEnabled = true
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	edits, err := organizeImports(context.Background(), bctx, newPackageIndex(), "e/", pkg, f, []byte(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `package a
+
+import (
+	"fmt"
+	"os"
+	// strings has a doc comment.
+	"strings"
+
+	"e/c"
+)
+
+func F() {
+	fmt.Println(os.Args, strings.ToUpper(""))
+	c.C()
+}
+`
+	if got := applyEdits(t, a, edits); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGroupImports(t *testing.T) {
+	const src = `package a
+
+import "C"
+
+import (
+	"example.com/x"
+	"os"
+	"local/y" // y
+	"fmt"
+
+	"example.com/z"
+)
+`
+	const want = `package a
+
+import "C"
+
+import (
+	"fmt"
+	"os"
+
+	"example.com/x"
+
+	"local/y" // y
+
+	"example.com/z"
+)
+`
+	got, err := groupImports([]byte(src), "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// initializeTestHandler returns a handler initialized with params, which
+// default to a workspace in /gopath/src/a using only the overlay, along
+// with its response. The overlay has a standard library package os.
+func initializeTestHandler(t *testing.T, params InitializeParams) (*LangHandler, lsp.InitializeResult) {
+	h := &LangHandler{HandlerShared: &HandlerShared{}}
+	params.RootURI = "file:///gopath/src/a"
+	params.NoOSFileSystemAccess = true
+	params.BuildContext = &InitializeBuildContextParams{
+		GOOS:     "linux",
+		GOARCH:   "amd64",
+		GOPATH:   "/gopath",
+		GOROOT:   "/goroot",
+		Compiler: "gc",
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := json.RawMessage(data)
+	result, err := h.Handle(context.Background(), nil, &jsonrpc2.Request{Method: "initialize", Params: &raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.overlay.set("file:///goroot/src/os/os.go", []byte("package os\n\nvar Args []string\n"))
+	return h, result.(lsp.InitializeResult)
+}
+
+func TestFormatOnSave(t *testing.T) {
+	ctx := context.Background()
+	initialize := func(formatOnSave bool) (*LangHandler, lsp.InitializeResult) {
+		var params InitializeParams
+		if formatOnSave {
+			params.InitializationOptions = map[string]interface{}{"formatOnSave": true}
+		}
+		return initializeTestHandler(t, params)
+	}
+	willSave := func(h *LangHandler, uri lsp.DocumentURI, src string) string {
+		h.overlay.set(uri, []byte(src))
+		edits, err := h.handleWillSaveWaitUntil(ctx, nil, nil, lsp.WillSaveTextDocumentParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", uri, err)
+		}
+		if edits == nil {
+			t.Fatalf("%s: got nil edits, want an array", uri)
+		}
+		return applyEdits(t, src, edits)
+	}
+
+	h, result := initialize(false)
+	if sync := result.Capabilities.TextDocumentSync; sync.Options != nil || sync.Kind == nil {
+		t.Errorf("got text document sync %+v without formatOnSave, want a kind only", sync)
+	}
+	const unformatted = "package a\n\nimport \"os\"\n\nfunc  F() {}\n"
+	if got := willSave(h, "file:///gopath/src/a/a.go", unformatted); got != unformatted {
+		t.Errorf("without formatOnSave: got %q, want the source unchanged", got)
+	}
+
+	h, result = initialize(true)
+	if sync := result.Capabilities.TextDocumentSync; sync.Options == nil || !sync.Options.WillSaveWaitUntil {
+		t.Errorf("got text document sync %+v with formatOnSave, want willSaveWaitUntil", sync)
+	}
+	tests := []struct {
+		uri       lsp.DocumentURI
+		src, want string
+	}{
+		// The file is formatted and its unused import removed.
+		{"file:///gopath/src/a/a.go", unformatted, "package a\n\nfunc F() {}\n"},
+		// Outside GOPATH the file cannot be type-checked, but it is
+		// still formatted.
+		{"file:///elsewhere/b.go", "package b\n\nimport \"os\"\n\nfunc  F() {}\n", "package b\n\nimport \"os\"\n\nfunc F() {}\n"},
+		// A file with syntax errors is saved as it is.
+		{"file:///gopath/src/a/a.go", "package a\n\nfunc  F( {}\n", "package a\n\nfunc  F( {}\n"},
+	}
+	for _, test := range tests {
+		if got := willSave(h, test.uri, test.src); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.uri, got, test.want)
+		}
+	}
+}
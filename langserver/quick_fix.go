@@ -0,0 +1,363 @@
+package langserver
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Codes go/types classifies its errors with, from go/internal/types/errors.
+// They are part of the export data format, so they never change.
+const (
+	codeUnusedImport   = 8
+	codeUndeclaredName = 75
+	codeUnusedVar      = 101
+	codeMissingReturn  = 102
+)
+
+// typeErrorCode returns the code of err, or 0 if go/types did not record
+// one. The code is unexported, but reflection can read it.
+func typeErrorCode(err types.Error) int {
+	field := reflect.ValueOf(err).FieldByName("go116code")
+	if !field.IsValid() || field.Kind() != reflect.Int {
+		return 0
+	}
+	return int(field.Int())
+}
+
+// quickFixes returns the fixes for the type errors of pkg in f, whose
+// source is src, that the client reported as the given diagnostics.
+func quickFixes(ctx context.Context, bctx *build.Context, packages *packageIndex, pkg *gotype.Package, f *ast.File, src []byte, diags []lsp.Diagnostic) []lsp.CodeAction {
+	x := &quickFixer{ctx: ctx, bctx: bctx, packages: packages, pkg: pkg, f: f, src: src}
+	filename := pkg.Fset.Position(f.Pos()).Filename
+	var actions []lsp.CodeAction
+	fixed := make(map[int]bool) // by index in diags
+	for _, err := range pkg.Errs {
+		typeErr, ok := err.(types.Error)
+		if !ok {
+			continue
+		}
+		errFilename, diag, _ := errorDiagnostic(typeErr)
+		if errFilename != filename {
+			continue
+		}
+		for i, d := range diags {
+			if fixed[i] || d.Range.Start != diag.Range.Start || d.Message != diag.Message {
+				continue
+			}
+			// The same error may be reported more than once.
+			fixed[i] = true
+			for _, action := range x.fixes(typeErr) {
+				action.Diagnostics = []lsp.Diagnostic{d}
+				actions = append(actions, action)
+			}
+			break
+		}
+	}
+	return actions
+}
+
+// quickFixer finds the fixes for type errors in a file.
+type quickFixer struct {
+	ctx      context.Context
+	bctx     *build.Context
+	packages *packageIndex
+	pkg      *gotype.Package
+	f        *ast.File
+	src      []byte
+}
+
+// fixes returns the fixes for err.
+func (x *quickFixer) fixes(err types.Error) []lsp.CodeAction {
+	path, _ := astutil.PathEnclosingInterval(x.f, err.Pos, err.Pos)
+	if len(path) == 0 {
+		return nil
+	}
+	switch typeErrorCode(err) {
+	case codeUndeclaredName:
+		return x.undeclaredName(path)
+	case codeUnusedImport:
+		return x.unusedImport(err.Pos)
+	case codeUnusedVar:
+		return x.unusedVar(path)
+	case codeMissingReturn:
+		return x.missingReturn(err.Pos)
+	}
+	return nil
+}
+
+// action returns a quick fix making the edits to the file.
+func (x *quickFixer) action(title string, edits ...lsp.TextEdit) lsp.CodeAction {
+	uri := pathToURI(x.pkg.Fset.Position(x.f.Pos()).Filename)
+	return lsp.CodeAction{Title: title, Kind: lsp.CAKQuickFix, IsPreferred: true, Edit: fileEdit(uri, edits)}
+}
+
+// undeclaredName imports the package an undeclared name is selected from,
+// or declares the undeclared names assigned to with =.
+func (x *quickFixer) undeclaredName(path []ast.Node) []lsp.CodeAction {
+	ident, ok := path[0].(*ast.Ident)
+	if !ok || len(path) < 2 {
+		return nil
+	}
+	switch parent := path[1].(type) {
+	case *ast.SelectorExpr:
+		if parent.X != ident {
+			return nil
+		}
+		members := unresolvedSelections(x.pkg, x.f)[ident.Name]
+		imp, ok := findImport(x.ctx, x.bctx, x.packages, x.pkg, ident.Name, members)
+		if !ok {
+			return nil
+		}
+		spec := strconv.Quote(imp.path)
+		if imp.name != "" {
+			spec = imp.name + " " + spec
+		}
+		return []lsp.CodeAction{x.action("Add import "+spec, addImportEdit(x.pkg.Fset, x.f, imp.name, imp.path))}
+
+	case *ast.AssignStmt:
+		if parent.Tok != token.ASSIGN || !x.canDefine(parent) {
+			return nil
+		}
+		edit := lsp.TextEdit{Range: rangeForPos(x.pkg.Fset, parent.TokPos, parent.TokPos+1), NewText: ":="}
+		return []lsp.CodeAction{x.action("Use := to declare "+ident.Name, edit)}
+	}
+	return nil
+}
+
+// canDefine reports whether assign, an assignment with =, can become a
+// short variable declaration without declaring a variable that shadows
+// one the assignment assigns to now.
+func (x *quickFixer) canDefine(assign *ast.AssignStmt) bool {
+	scope := x.pkg.Types.Scope().Innermost(assign.Pos())
+	if scope == nil || scope == x.pkg.Types.Scope() {
+		return false
+	}
+	for _, lhs := range assign.Lhs {
+		id, ok := lhs.(*ast.Ident)
+		if !ok {
+			return false
+		}
+		if obj := x.pkg.Info.Uses[id]; obj != nil && obj.Parent() != scope {
+			return false
+		}
+	}
+	return true
+}
+
+// unusedImport removes the import at pos, and its declaration if it is the
+// only import in it.
+func (x *quickFixer) unusedImport(pos token.Pos) []lsp.CodeAction {
+	for _, d := range x.f.Decls {
+		decl, ok := d.(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT {
+			continue
+		}
+		for _, s := range decl.Specs {
+			spec := s.(*ast.ImportSpec)
+			if pos < spec.Pos() || pos >= spec.End() {
+				continue
+			}
+			var edit lsp.TextEdit
+			if len(decl.Specs) == 1 {
+				edit = removeEdit(x.pkg.Fset, x.src, nodeStart(decl, decl.Doc), decl.End())
+			} else {
+				edit = removeEdit(x.pkg.Fset, x.src, nodeStart(spec, spec.Doc), spec.End())
+			}
+			return []lsp.CodeAction{x.action("Remove unused import "+spec.Path.Value, edit)}
+		}
+	}
+	return nil
+}
+
+// unusedVar removes the declaration of an unused variable, or replaces its
+// name by _ if the declaration does more.
+func (x *quickFixer) unusedVar(path []ast.Node) []lsp.CodeAction {
+	ident, ok := path[0].(*ast.Ident)
+	if !ok || len(path) < 3 {
+		return nil
+	}
+	fset := x.pkg.Fset
+	remove := func(edits ...lsp.TextEdit) []lsp.CodeAction {
+		return []lsp.CodeAction{x.action("Remove unused variable "+ident.Name, edits...)}
+	}
+	blank := func(edits ...lsp.TextEdit) []lsp.CodeAction {
+		edits = append([]lsp.TextEdit{{Range: rangeForNode(fset, ident), NewText: "_"}}, edits...)
+		return []lsp.CodeAction{x.action("Replace unused variable "+ident.Name+" with _", edits...)}
+	}
+
+	switch parent := path[1].(type) {
+	case *ast.ValueSpec:
+		decl, ok := path[2].(*ast.GenDecl)
+		if !ok || len(path) < 4 {
+			return nil
+		}
+		if stmt, ok := path[3].(*ast.DeclStmt); ok && len(decl.Specs) == 1 && len(parent.Names) == 1 && sideEffectFree(parent.Values) && inStmtList(path[4:]) {
+			return remove(removeEdit(x.pkg.Fset, x.src, stmt.Pos(), stmt.End()))
+		}
+		return blank()
+
+	case *ast.AssignStmt:
+		if parent.Tok != token.DEFINE {
+			return nil
+		}
+		if sw, ok := path[2].(*ast.TypeSwitchStmt); ok && sw.Assign == parent {
+			return remove(lsp.TextEdit{Range: rangeForPos(fset, ident.Pos(), parent.Rhs[0].Pos())})
+		}
+		if len(parent.Lhs) == 1 && sideEffectFree(parent.Rhs) && inStmtList(path[2:]) {
+			return remove(removeEdit(x.pkg.Fset, x.src, parent.Pos(), parent.End()))
+		}
+		for _, lhs := range parent.Lhs {
+			if id, ok := lhs.(*ast.Ident); ok && id != ident && x.pkg.Info.Defs[id] != nil {
+				return blank()
+			}
+		}
+		// With no new variables left to declare, := becomes =.
+		return blank(lsp.TextEdit{Range: rangeForPos(fset, parent.TokPos, parent.TokPos+2), NewText: "="})
+
+	case *ast.RangeStmt:
+		switch {
+		case ident == parent.Value:
+			return remove(lsp.TextEdit{Range: rangeForPos(fset, parent.Key.End(), parent.Value.End())})
+		case ident == parent.Key && parent.Value == nil:
+			return remove(lsp.TextEdit{Range: rangeForPos(fset, parent.Key.Pos(), parent.X.Pos())})
+		case ident == parent.Key:
+			return blank()
+		}
+	}
+	return nil
+}
+
+// inStmtList reports whether the innermost node of path, the parents of a
+// statement, holds it in a list of statements, from which it can be
+// removed.
+func inStmtList(path []ast.Node) bool {
+	if len(path) == 0 {
+		return false
+	}
+	switch path[0].(type) {
+	case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+		return true
+	}
+	return false
+}
+
+// sideEffectFree reports whether evaluating exprs certainly has no side
+// effects, so that they can be removed.
+func sideEffectFree(exprs []ast.Expr) bool {
+	for _, e := range exprs {
+		free := true
+		ast.Inspect(e, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false // declaring a function does nothing
+			case *ast.CallExpr, *ast.IndexExpr, *ast.SliceExpr, *ast.StarExpr, *ast.TypeAssertExpr:
+				free = false
+			case *ast.UnaryExpr:
+				if n.Op == token.ARROW {
+					free = false
+				}
+			}
+			return free
+		})
+		if !free {
+			return false
+		}
+	}
+	return true
+}
+
+// missingReturn adds a return statement of zero values to the end of the
+// function whose body ends at rbrace.
+func (x *quickFixer) missingReturn(rbrace token.Pos) []lsp.CodeAction {
+	var sig *types.Signature
+	ast.Inspect(x.f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil && n.Body.Rbrace == rbrace {
+				sig, _ = x.pkg.Info.Defs[n.Name].Type().(*types.Signature)
+			}
+		case *ast.FuncLit:
+			if n.Body.Rbrace == rbrace {
+				sig, _ = x.pkg.Info.TypeOf(n).(*types.Signature)
+			}
+		}
+		return sig == nil
+	})
+	if sig == nil || sig.Results().Len() == 0 {
+		return nil
+	}
+
+	ret := "return"
+	if sig.Results().At(0).Name() == "" {
+		qf := fileQualifier(x.f, x.pkg.Types, x.pkg.Info)
+		zeros := make([]string, sig.Results().Len())
+		for i := range zeros {
+			zeros[i] = zeroValue(sig.Results().At(i).Type(), qf)
+		}
+		ret += " " + strings.Join(zeros, ", ")
+	}
+
+	tf := x.pkg.Fset.File(rbrace)
+	offset := tf.Offset(rbrace)
+	lineStart := bytes.LastIndexByte(x.src[:offset], '\n') + 1
+	before := x.src[lineStart:offset]
+	indent := before[:len(before)-len(bytes.TrimLeft(before, " \t"))]
+	var edit lsp.TextEdit
+	if len(indent) == len(before) {
+		pos := positionForPos(x.pkg.Fset, tf.Pos(lineStart))
+		edit = lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: string(indent) + "\t" + ret + "\n"}
+	} else {
+		pos := positionForPos(x.pkg.Fset, rbrace)
+		edit = lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: "\n" + string(indent) + "\t" + ret + "\n" + string(indent)}
+	}
+	return []lsp.CodeAction{x.action("Add return statement", edit)}
+}
+
+// removeEdit returns an edit removing the source src between start and
+// end. If nothing else is on their lines but a comment after end, the lines
+// are removed entirely.
+func removeEdit(fset *token.FileSet, src []byte, start, end token.Pos) lsp.TextEdit {
+	tf := fset.File(start)
+	s, e := tf.Offset(start), tf.Offset(end)
+	ls := s
+	for ls > 0 && (src[ls-1] == ' ' || src[ls-1] == '\t') {
+		ls--
+	}
+	le := e
+	for le < len(src) && (src[le] == ' ' || src[le] == '\t') {
+		le++
+	}
+	if bytes.HasPrefix(src[le:], []byte("//")) {
+		if i := bytes.IndexByte(src[le:], '\n'); i >= 0 {
+			le += i
+		} else {
+			le = len(src)
+		}
+	}
+	if (ls == 0 || src[ls-1] == '\n') && (le == len(src) || src[le] == '\n') {
+		if le < len(src) {
+			le++
+		}
+		s, e = ls, le
+	}
+	return lsp.TextEdit{Range: rangeForPos(fset, tf.Pos(s), tf.Pos(e))}
+}
+
+// nodeStart returns the start of n, including its doc comment.
+func nodeStart(n ast.Node, doc *ast.CommentGroup) token.Pos {
+	if doc != nil {
+		return doc.Pos()
+	}
+	return n.Pos()
+}
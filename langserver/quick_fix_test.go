@@ -0,0 +1,102 @@
+package langserver
+
+import (
+	"context"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/buildutil"
+)
+
+func TestQuickFixes(t *testing.T) {
+	const a = `package a
+
+import (
+	"os"
+	"strings"
+)
+
+func F() int {
+	x = 1
+	fmt.Println(strings.ToUpper(""))
+	y := 2
+	var z int
+	for i, v := range []int{} {
+		_ = i
+	}
+	a, b := G()
+	_ = a
+}
+
+func G() (int, error) {
+	return 0, nil }
+`
+	pkgs := map[string]map[string]string{
+		"a":       {"a.go": a},
+		"fmt":     {"fmt.go": "package fmt\n\nfunc Println(a ...interface{}) {}\n"},
+		"os":      {"os.go": "package os\n"},
+		"strings": {"strings.go": "package strings\n\nfunc ToUpper(s string) string { return s }\n"},
+	}
+	bctx := buildutil.FakeContext(pkgs)
+	bctx.CgoEnabled = true
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	var diags []lsp.Diagnostic
+	seen := make(map[string]bool)
+	for _, err := range pkg.Errs {
+		if _, ok := err.(types.Error); ok && !seen[err.Error()] {
+			seen[err.Error()] = true
+			_, d, _ := errorDiagnostic(err)
+			diags = append(diags, *d)
+		}
+	}
+	actions := quickFixes(context.Background(), bctx, newPackageIndex(), pkg, f, []byte(a), diags)
+
+	want := map[string]string{
+		`Remove unused import "os"`:        "import (\n\t\"strings\"\n)",
+		`Use := to declare x`:              "\tx := 1\n",
+		`Add import "fmt"`:                 "import (\n\t\"fmt\"\n\t\"os\"",
+		`Remove unused variable y`:         "\tfmt.Println(strings.ToUpper(\"\"))\n\tvar z int\n",
+		`Remove unused variable z`:         "\ty := 2\n\tfor i, v",
+		`Remove unused variable v`:         "\tfor i := range []int{} {\n",
+		`Replace unused variable b with _`: "\ta, _ := G()\n",
+		`Add return statement`:             "\t_ = a\n\treturn 0\n}\n",
+	}
+	got := make(map[string]string)
+	for _, action := range actions {
+		if len(action.Diagnostics) != 1 || action.Kind != lsp.CAKQuickFix {
+			t.Errorf("%s: got kind %q and diagnostics %v", action.Title, action.Kind, action.Diagnostics)
+		}
+		got[action.Title] = applyEdits(t, a, action.Edit.Changes["file:///go/src/a/a.go"])
+	}
+	for title, fragment := range want {
+		src, ok := got[title]
+		if !ok {
+			t.Errorf("no %q fix among %d", title, len(actions))
+			continue
+		}
+		if !strings.Contains(src, fragment) {
+			t.Errorf("%s: fixed source does not contain %q:\n%s", title, fragment, src)
+		}
+	}
+	if len(actions) != len(want) {
+		t.Errorf("got %d fixes, want %d", len(actions), len(want))
+	}
+}
+
+func TestQuickFixesMissingReturnOnLine(t *testing.T) {
+	const a = "package a\n\nfunc F() (string, *int) { println() }\n"
+	pkgs := map[string]map[string]string{"a": {"a.go": a}}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+	_, d, _ := errorDiagnostic(pkg.Errs[0])
+	actions := quickFixes(context.Background(), nil, newPackageIndex(), pkg, f, []byte(a), []lsp.Diagnostic{*d})
+	if len(actions) != 1 {
+		t.Fatalf("got %d fixes, want 1", len(actions))
+	}
+	want := "package a\n\nfunc F() (string, *int) { println() \n\treturn \"\", nil\n}\n"
+	if got := applyEdits(t, a, actions[0].Edit.Changes["file:///go/src/a/a.go"]); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
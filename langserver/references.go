@@ -0,0 +1,174 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleReferences(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.ReferenceParams) ([]lsp.Location, error) {
+	pkg, f, err := h.typecheck(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	locs, err := references(ctx, h.checkBuildContext(ctx), h.RootFSPath, pkg, f, params.Position, params.Context.IncludeDeclaration)
+	if err != nil {
+		return nil, err
+	}
+	if params.Context.XLimit > 0 && len(locs) > params.Context.XLimit {
+		locs = locs[:params.Context.XLimit]
+	}
+	return locs, nil
+}
+
+// references returns the locations of all references to the object at
+// position p in f, found in pkg and in the packages under root that may
+// refer to it. The results are sorted by file and position.
+func references(ctx context.Context, bctx *build.Context, root string, pkg *gotype.Package, f *ast.File, p lsp.Position, includeDecl bool) ([]lsp.Location, error) {
+	_, obj, err := objectAtPosition(pkg, f, p)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return []lsp.Location{}, nil
+	}
+	if obj.Pkg() == nil || !obj.Pos().IsValid() {
+		return nil, fmt.Errorf("cannot find references to builtin %s", obj.Name())
+	}
+	target := keyForObject(pkg.Fset, obj)
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[lsp.Location]bool)
+		locs = []lsp.Location{}
+	)
+	collect := func(pkg *gotype.Package) {
+		found := findReferences(pkg, target)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, loc := range found {
+			if !seen[loc] {
+				seen[loc] = true
+				locs = append(locs, loc)
+			}
+		}
+	}
+
+	collect(pkg)
+	if !isLocal(obj) {
+		if err := checkReferrers(ctx, bctx, root, obj, collect); err != nil {
+			return nil, err
+		}
+	}
+
+	if includeDecl {
+		if _, ok := obj.(*types.PkgName); !ok {
+			if loc, ok := objectLocation(pkg, obj); ok && !seen[loc] {
+				locs = append(locs, loc)
+			}
+		}
+	}
+	sortLocations(locs)
+	return locs, nil
+}
+
+// checkReferrers type-checks the packages under root that may refer to obj,
+// which must not be local, and calls fn with each of them. Like
+// checkPackages, it calls fn concurrently.
+func checkReferrers(ctx context.Context, bctx *build.Context, root string, obj types.Object, fn func(*gotype.Package)) error {
+	pkgs, err := workspacePackages(ctx, bctx, root)
+	if err != nil {
+		return err
+	}
+	declPath := strings.TrimSuffix(obj.Pkg().Path(), "_test")
+	if obj.Exported() {
+		pkgs = importers(pkgs, declPath)
+	} else {
+		// Unexported objects can only be referred to from their own
+		// package.
+		pkgs = packagesWithPath(pkgs, declPath)
+	}
+	checkPackages(ctx, bctx, pkgs, func(dir string, files []string) bool {
+		return mentions(bctx, dir, files, obj.Name())
+	}, fn)
+	return ctx.Err()
+}
+
+// objectKey identifies an object by the position of its declaration. Unlike
+// the types.Object itself, it is the same across separate type-checks of the
+// same code.
+type objectKey struct {
+	filename string
+	offset   int
+	name     string
+}
+
+func keyForObject(fset *token.FileSet, obj types.Object) objectKey {
+	p := fset.PositionFor(obj.Pos(), false)
+	return objectKey{filename: p.Filename, offset: p.Offset, name: obj.Name()}
+}
+
+// findReferences returns the locations of the identifiers in pkg that refer
+// to the object identified by target.
+func findReferences(pkg *gotype.Package, target objectKey) []lsp.Location {
+	var locs []lsp.Location
+	for ident, obj := range pkg.Info.Uses {
+		if obj.Name() == target.name && obj.Pos().IsValid() && keyForObject(pkg.Fset, obj) == target {
+			locs = append(locs, locationForNode(pkg.Fset, ident))
+		}
+	}
+	return locs
+}
+
+// isLocal reports whether obj can only be referred to from within the
+// function or file that declares it.
+func isLocal(obj types.Object) bool {
+	if _, ok := obj.(*types.PkgName); ok {
+		return true
+	}
+	if v, ok := obj.(*types.Var); ok && v.IsField() {
+		return false
+	}
+	if fn, ok := obj.(*types.Func); ok && fn.Type().(*types.Signature).Recv() != nil {
+		return false
+	}
+	return obj.Parent() != nil && obj.Parent() != obj.Pkg().Scope()
+}
+
+func packagesWithPath(pkgs []*build.Package, importPath string) []*build.Package {
+	for _, bp := range pkgs {
+		if bp.ImportPath == importPath {
+			return []*build.Package{bp}
+		}
+	}
+	return nil
+}
+
+// sortLocations sorts locs by file and then by position.
+func sortLocations(locs []lsp.Location) {
+	sort.Slice(locs, func(i, j int) bool {
+		return locationLess(locs[i], locs[j])
+	})
+}
+
+// locationLess reports whether a comes before b, ordering by file and then
+// by position.
+func locationLess(a, b lsp.Location) bool {
+	if a.URI != b.URI {
+		return a.URI < b.URI
+	}
+	if a.Range.Start.Line != b.Range.Start.Line {
+		return a.Range.Start.Line < b.Range.Start.Line
+	}
+	return a.Range.Start.Character < b.Range.Start.Character
+}
@@ -0,0 +1,133 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/adamfaulkner/go-langserver/pkg/lspext"
+	"golang.org/x/tools/go/buildutil"
+)
+
+func TestReferences(t *testing.T) {
+	const a = `package a
+
+func F() {}
+
+func g() { F() }
+`
+	pkgs := map[string]map[string]string{
+		"a": {
+			"a.go":      a,
+			"a_test.go": "package a\n\nfunc h() { F() }\n",
+			"x_test.go": "package a_test\n\nimport \"a\"\n\nfunc h() { a.F() }\n",
+		},
+		"b": {"b.go": "package b\n\nimport \"a\"\n\nvar _ = a.F\n"},
+		"c": {"c.go": "package c\n\nfunc F() {}\n\nvar _ = F\n"},
+	}
+	bctx := buildutil.FakeContext(pkgs)
+	bctx.CgoEnabled = true
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	loc := func(file string, line, char int) lsp.Location {
+		return lsp.Location{
+			URI:   lsp.DocumentURI("file:///go/src/" + file),
+			Range: lsp.Range{Start: lsp.Position{Line: line, Character: char}, End: lsp.Position{Line: line, Character: char + 1}},
+		}
+	}
+	for _, includeDecl := range []bool{false, true} {
+		got, err := references(context.Background(), bctx, "/go/src", pkg, f, positionOf(t, a, "F() }"), includeDecl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []lsp.Location{
+			loc("a/a.go", 4, 11),
+			loc("a/a_test.go", 2, 11),
+			loc("a/x_test.go", 4, 13),
+			loc("b/b.go", 4, 10),
+		}
+		if includeDecl {
+			want = append(want[:1], want...)
+			want[0] = loc("a/a.go", 2, 5)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("includeDecl=%v: got %+v, want %+v", includeDecl, got, want)
+		}
+	}
+}
+
+func TestWorkspaceReferences(t *testing.T) {
+	pkgs := map[string]map[string]string{
+		"a": {"a.go": "package a\n\ntype T struct{ F int }\n\nfunc (T) M() {}\n\nfunc M() {}\n"},
+		"b": {"b.go": "package b\n\nimport \"a\"\n\nvar _ = a.T{}.M\nvar _ = a.M\n"},
+		"c": {"c.go": "package c\n\nimport \"a\"\n\nvar _ = a.T{}.F\nvar _ = a.M\n"},
+	}
+	bctx := buildutil.FakeContext(pkgs)
+	bctx.CgoEnabled = true
+
+	tests := []struct {
+		params lspext.WorkspaceReferencesParams
+		want   []string
+	}{
+		{
+			params: lspext.WorkspaceReferencesParams{Query: lspext.SymbolDescriptor{"package": "a", "name": "M"}},
+			want:   []string{"b/b.go:4 recv:T", "b/b.go:5 recv:", "c/c.go:5 recv:"},
+		},
+		{
+			params: lspext.WorkspaceReferencesParams{Query: lspext.SymbolDescriptor{"package": "a", "name": "M", "recv": "T"}},
+			want:   []string{"b/b.go:4 recv:T"},
+		},
+		{
+			params: lspext.WorkspaceReferencesParams{Query: lspext.SymbolDescriptor{"name": "M"}, Hints: map[string]interface{}{"dirs": []interface{}{"c"}}},
+			want:   []string{"c/c.go:5 recv:"},
+		},
+		{
+			params: lspext.WorkspaceReferencesParams{Query: lspext.SymbolDescriptor{"kind": "field"}},
+			want:   []string{"c/c.go:4 recv:T"},
+		},
+	}
+	for _, test := range tests {
+		var emitted int
+		refs, err := workspaceReferences(context.Background(), bctx, "/go/src", test.params, func(lspext.ReferenceInformation) { emitted++ })
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, ref := range refs {
+			file := strings.TrimPrefix(string(ref.Reference.URI), "file:///go/src/")
+			got = append(got, fmt.Sprintf("%s:%d recv:%s", file, ref.Reference.Range.Start.Line, ref.Symbol["recv"]))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %q, want %q", test.params.Query, got, test.want)
+		}
+		if emitted != len(refs) {
+			t.Errorf("%v: emitted %d references, want %d", test.params.Query, emitted, len(refs))
+		}
+	}
+
+	// The references within the limit are the first ones, not whichever
+	// were found first.
+	var emitted []lspext.ReferenceInformation
+	refs, err := workspaceReferences(context.Background(), bctx, "/go/src", lspext.WorkspaceReferencesParams{Query: lspext.SymbolDescriptor{"name": "M"}, Limit: 2}, func(ref lspext.ReferenceInformation) { emitted = append(emitted, ref) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 2 || refs[0].Reference.URI != "file:///go/src/b/b.go" || refs[1].Reference.URI != "file:///go/src/b/b.go" {
+		t.Errorf("got references %v with limit 2, want the two in b/b.go", refs)
+	}
+	if !reflect.DeepEqual(emitted, refs) {
+		t.Errorf("emitted %v with limit 2, want %v", emitted, refs)
+	}
+
+	// Query values need not be comparable.
+	refs, err = workspaceReferences(context.Background(), bctx, "/go/src", lspext.WorkspaceReferencesParams{Query: lspext.SymbolDescriptor{"name": "M", "recv": []interface{}{"T"}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 0 {
+		t.Errorf("got references %v for a list receiver, want none", refs)
+	}
+}
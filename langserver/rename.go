@@ -0,0 +1,391 @@
+package langserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleRename(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.RenameParams) (*lsp.WorkspaceEdit, error) {
+	pkg, f, err := h.typecheck(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return rename(ctx, h.checkBuildContext(ctx), h.RootFSPath, pkg, f, params.Position, params.NewName)
+}
+
+func (h *LangHandler) handlePrepareRename(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) (*lsp.Range, error) {
+	pkg, f, err := h.typecheck(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return prepareRename(h.RootFSPath, pkg, f, params.Position)
+}
+
+// prepareRename returns the range of the identifier at position p in f, or
+// an error saying why it cannot be renamed.
+func prepareRename(root string, pkg *gotype.Package, f *ast.File, p lsp.Position) (*lsp.Range, error) {
+	ident, _, err := renameTarget(root, pkg, f, p)
+	if err != nil {
+		return nil, err
+	}
+	r := rangeForNode(pkg.Fset, ident)
+	return &r, nil
+}
+
+// renameTarget returns the identifier at position p in f along with the
+// object it denotes, which must be declared in a package under root.
+func renameTarget(root string, pkg *gotype.Package, f *ast.File, p lsp.Position) (*ast.Ident, types.Object, error) {
+	node, obj, err := objectAtPosition(pkg, f, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	ident, ok := node.(*ast.Ident)
+	if !ok || obj == nil {
+		return nil, nil, errors.New("no identifier to rename at this position")
+	}
+	// An embedded field is declared by naming its type, which is what
+	// gets renamed.
+	if use := pkg.Info.Uses[ident]; use != nil {
+		obj = use
+	}
+	if obj.Pkg() == nil || !obj.Pos().IsValid() {
+		return nil, nil, fmt.Errorf("cannot rename builtin %s", obj.Name())
+	}
+	if v, ok := obj.(*types.Var); ok && v.Anonymous() {
+		return nil, nil, fmt.Errorf("cannot rename embedded field %s: rename its type instead", obj.Name())
+	}
+	if filename := pkg.Fset.Position(obj.Pos()).Filename; !PathHasPrefix(filename, root) {
+		return nil, nil, fmt.Errorf("cannot rename %s: it is declared outside the workspace, in %s", obj.Name(), filename)
+	}
+	if fn, ok := obj.(*types.Func); ok && fn.Parent() == fn.Pkg().Scope() {
+		if fn.Name() == "init" || fn.Name() == "main" && fn.Pkg().Name() == "main" {
+			return nil, nil, fmt.Errorf("cannot rename the %s function", fn.Name())
+		}
+	}
+	return ident, obj, nil
+}
+
+// rename returns the edits renaming the object at position p in f to
+// newName, throughout the packages under root. Renames that would change
+// the meaning of the code or break it are refused: when the new name would
+// be shadowed at a reference or capture references to another object, when
+// a type would get two fields or methods of the same name, when a type
+// would stop implementing an interface, and when an object referred to from
+// other packages would become unexported.
+func rename(ctx context.Context, bctx *build.Context, root string, pkg *gotype.Package, f *ast.File, p lsp.Position, newName string) (*lsp.WorkspaceEdit, error) {
+	_, obj, err := renameTarget(root, pkg, f, p)
+	if err != nil {
+		return nil, err
+	}
+	if !token.IsIdentifier(newName) || newName == "_" {
+		return nil, fmt.Errorf("%q is not a valid identifier", newName)
+	}
+	r := &renamer{
+		obj:     obj,
+		target:  keyForObject(pkg.Fset, obj),
+		newName: newName,
+		edits:   make(map[lsp.Location]string),
+	}
+	if newName == obj.Name() {
+		return r.workspaceEdit(), nil
+	}
+
+	if err := r.checkMembers(ctx, bctx, root, pkg); err != nil {
+		return nil, err
+	}
+	r.collect(pkg)
+	if !isLocal(obj) {
+		if err := checkReferrers(ctx, bctx, root, obj, r.collect); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := obj.(*types.PkgName); ok {
+		r.nameImport(pkg)
+	} else if loc, ok := objectLocation(pkg, obj); ok {
+		r.edits[loc] = newName
+	}
+
+	if len(r.conflicts) > 0 {
+		sort.Strings(r.conflicts)
+		return nil, fmt.Errorf("cannot rename %s to %s: %s", obj.Name(), newName, r.conflicts[0])
+	}
+	return r.workspaceEdit(), nil
+}
+
+// renamer collects the edits and conflicts of renaming an object.
+type renamer struct {
+	obj     types.Object
+	target  objectKey
+	newName string
+
+	mu        sync.Mutex
+	edits     map[lsp.Location]string // replacement text by location
+	conflicts []string
+}
+
+func (r *renamer) conflict(format string, args ...interface{}) {
+	r.mu.Lock()
+	r.conflicts = append(r.conflicts, fmt.Sprintf(format, args...))
+	r.mu.Unlock()
+}
+
+// matches reports whether obj is the object being renamed.
+func (r *renamer) matches(fset *token.FileSet, obj types.Object) bool {
+	return obj != nil && obj.Name() == r.target.name && obj.Pos().IsValid() && keyForObject(fset, obj) == r.target
+}
+
+// isEmbeddedField reports whether obj is a field embedding the type being
+// renamed, and so is renamed along with it.
+func (r *renamer) isEmbeddedField(fset *token.FileSet, obj types.Object) bool {
+	if _, ok := r.obj.(*types.TypeName); !ok {
+		return false
+	}
+	v, ok := obj.(*types.Var)
+	if !ok || !v.Anonymous() {
+		return false
+	}
+	T := v.Type()
+	if ptr, ok := T.(*types.Pointer); ok {
+		T = ptr.Elem()
+	}
+	named, ok := T.(*types.Named)
+	return ok && r.matches(fset, named.Obj())
+}
+
+// collect records the edits renaming the references in p and checks them
+// for conflicts. It may be called concurrently.
+func (r *renamer) collect(p *gotype.Package) {
+	var (
+		refs  []*ast.Ident
+		local types.Object // p's copy of the object
+	)
+	for ident, obj := range p.Info.Defs {
+		if r.matches(p.Fset, obj) {
+			refs = append(refs, ident)
+			local = obj
+		}
+	}
+	for ident, obj := range p.Info.Uses {
+		switch {
+		case r.matches(p.Fset, obj):
+			refs = append(refs, ident)
+			local = obj
+		case r.isEmbeddedField(p.Fset, obj):
+			refs = append(refs, ident)
+		}
+	}
+	for _, obj := range p.Info.Implicits {
+		if r.matches(p.Fset, obj) {
+			local = obj // a type switch guard
+		}
+	}
+	if len(refs) == 0 && local == nil {
+		return
+	}
+
+	r.mu.Lock()
+	for _, ident := range refs {
+		r.edits[locationForNode(p.Fset, ident)] = r.newName
+	}
+	r.mu.Unlock()
+
+	declPath := strings.TrimSuffix(r.obj.Pkg().Path(), "_test")
+	if len(refs) > 0 && !ast.IsExported(r.newName) && strings.TrimSuffix(p.Types.Path(), "_test") != declPath {
+		r.conflict("%s is referred to from package %s, so it must stay exported", r.obj.Name(), p.Types.Path())
+	}
+	if local != nil {
+		r.checkScope(p, local, refs)
+	}
+	r.checkSelections(p)
+}
+
+// checkScope checks that after renaming local, which is declared in a scope
+// of p, refs still refer to it and no other reference starts to.
+func (r *renamer) checkScope(p *gotype.Package, local types.Object, refs []*ast.Ident) {
+	scope := local.Parent()
+	if scope == nil || local.Pkg() != p.Types {
+		// Fields and methods are checked by checkSelections, and
+		// references from other packages are qualified.
+		return
+	}
+	if other := scope.Lookup(r.newName); other != nil {
+		r.conflict("%s is already declared at %s", r.newName, p.Fset.Position(other.Pos()))
+		return
+	}
+	switch local.(type) {
+	case *types.PkgName:
+		if other := p.Types.Scope().Lookup(r.newName); other != nil {
+			r.conflict("the import would conflict with %s declared at %s", r.newName, p.Fset.Position(other.Pos()))
+		}
+	default:
+		if scope == p.Types.Scope() {
+			for _, f := range p.Files {
+				if other := p.Info.Scopes[f].Lookup(r.newName); other != nil {
+					r.conflict("%s would conflict with the import at %s", r.newName, p.Fset.Position(other.Pos()))
+				}
+			}
+		}
+	}
+
+	for _, ident := range refs {
+		inner := p.Types.Scope().Innermost(ident.Pos())
+		if inner == nil {
+			continue
+		}
+		if _, other := inner.LookupParent(r.newName, ident.Pos()); other != nil && other.Parent() != scope && isInside(other.Parent(), scope) {
+			r.conflict("the reference at %s would be shadowed by the %s declared at %s", p.Fset.Position(ident.Pos()), r.newName, p.Fset.Position(other.Pos()))
+		}
+	}
+
+	for ident, other := range p.Info.Uses {
+		if other.Name() != r.newName || other.Parent() == nil || other.Parent() == scope || !isInside(scope, other.Parent()) {
+			continue
+		}
+		if scope != p.Types.Scope() && !(scope.Contains(ident.Pos()) && ident.Pos() > local.Pos()) {
+			continue
+		}
+		r.conflict("the reference to %s at %s would refer to the renamed %s instead", r.newName, p.Fset.Position(ident.Pos()), r.obj.Name())
+	}
+}
+
+// checkSelections checks that the field or method selections in p of the
+// object being renamed would not select something else under the new name.
+func (r *renamer) checkSelections(p *gotype.Package) {
+	for sel, s := range p.Info.Selections {
+		if !r.matches(p.Fset, s.Obj()) {
+			continue
+		}
+		obj, index, _ := types.LookupFieldOrMethod(s.Recv(), true, s.Obj().Pkg(), r.newName)
+		if (obj != nil || index != nil) && len(index) <= len(s.Index()) {
+			r.conflict("the selection at %s would be shadowed by %s of %s", p.Fset.Position(sel.Sel.Pos()), r.newName, s.Recv())
+		}
+	}
+}
+
+// checkMembers checks that renaming a field or method leaves its type
+// without duplicate names and implementing the same interfaces.
+func (r *renamer) checkMembers(ctx context.Context, bctx *build.Context, root string, pkg *gotype.Package) error {
+	var T types.Type
+	switch obj := r.obj.(type) {
+	case *types.Func:
+		recv := obj.Type().(*types.Signature).Recv()
+		if recv == nil {
+			return nil
+		}
+		T = recv.Type()
+		if ptr, ok := T.(*types.Pointer); ok {
+			T = ptr.Elem()
+		}
+	case *types.Var:
+		if !obj.IsField() {
+			return nil
+		}
+		// Fields of unnamed structs are only checked where they are
+		// selected.
+		tn, ok := obj.Pkg().Scope().Lookup(recvName(pkg, obj)).(*types.TypeName)
+		if !ok || !hasField(tn.Type(), obj) {
+			return nil
+		}
+		T = tn.Type()
+	default:
+		return nil
+	}
+	if other, _, _ := types.LookupFieldOrMethod(T, true, r.obj.Pkg(), r.newName); other != nil {
+		r.conflict("%s already has a field or method %s", T, r.newName)
+	}
+
+	method, ok := r.obj.(*types.Func)
+	named, isNamed := T.(*types.Named)
+	if !ok || !isNamed {
+		return nil
+	}
+	pkgs, err := workspaceTypes(ctx, bctx, root, pkg)
+	if err != nil {
+		return err
+	}
+	T = canonicalType(pkg, pkgs, named)
+	if iface, ok := T.Underlying().(*types.Interface); ok {
+		for _, C := range namedTypes(pkgs) {
+			if !types.IsInterface(C) && implements(C, iface) {
+				r.conflict("%s would no longer implement %s", C, T)
+			}
+		}
+		return nil
+	}
+	for _, I := range namedTypes(dependencies(pkgs)) {
+		iface, ok := I.Underlying().(*types.Interface)
+		if ok && !iface.Empty() && implements(T, iface) && lookupMethod(I, method) != nil {
+			r.conflict("%s would no longer implement %s", T, I)
+		}
+	}
+	return nil
+}
+
+// hasField reports whether field is a field of the struct underlying T.
+func hasField(T types.Type, field *types.Var) bool {
+	st, ok := T.Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i) == field {
+			return true
+		}
+	}
+	return false
+}
+
+// nameImport records the edit naming the import of the package name being
+// renamed, if it is implicit.
+func (r *renamer) nameImport(pkg *gotype.Package) {
+	for _, f := range pkg.Files {
+		for _, spec := range f.Imports {
+			if spec.Name == nil && pkg.Info.Implicits[spec] == r.obj {
+				loc := locationForPos(pkg.Fset, spec.Path.Pos(), spec.Path.Pos())
+				r.edits[loc] = r.newName + " "
+			}
+		}
+	}
+}
+
+// workspaceEdit returns the collected edits, sorted by position in each
+// file.
+func (r *renamer) workspaceEdit() *lsp.WorkspaceEdit {
+	changes := make(map[string][]lsp.TextEdit)
+	for loc, text := range r.edits {
+		uri := string(loc.URI)
+		changes[uri] = append(changes[uri], lsp.TextEdit{Range: loc.Range, NewText: text})
+	}
+	for _, edits := range changes {
+		sort.Slice(edits, func(i, j int) bool {
+			a, b := edits[i].Range.Start, edits[j].Range.Start
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Character < b.Character
+		})
+	}
+	return &lsp.WorkspaceEdit{Changes: changes}
+}
+
+// isInside reports whether scope s is inner, or equal, to outer.
+func isInside(s, outer *types.Scope) bool {
+	for ; s != nil; s = s.Parent() {
+		if s == outer {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,422 @@
+package langserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+	"golang.org/x/tools/go/buildutil"
+)
+
+// Commands run by workspace/executeCommand.
+const (
+	// commandRenamePackage renames a package. Its arguments are the URI
+	// of the package's directory, or of a file in it, and the new name.
+	commandRenamePackage = "go.renamePackage"
+
+	// commandMovePackage moves the directory of a package, along with
+	// the packages in its subdirectories. Its arguments are the URIs of
+	// the directory and of its new location.
+	commandMovePackage = "go.movePackage"
+)
+
+func (h *LangHandler) handleExecuteCommand(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.ExecuteCommandParams) (interface{}, error) {
+	bctx := h.BuildContext(ctx)
+	var (
+		edit *lsp.WorkspaceEdit
+		err  error
+	)
+	switch params.Command {
+	case commandRenamePackage:
+		var (
+			uri     lsp.DocumentURI
+			newName string
+		)
+		if err := commandArguments(params.Arguments, &uri, &newName); err != nil {
+			return nil, err
+		}
+		edit, err = renamePackage(ctx, bctx, h.FilePath(uri), newName)
+
+	case commandMovePackage:
+		var from, to lsp.DocumentURI
+		if err := commandArguments(params.Arguments, &from, &to); err != nil {
+			return nil, err
+		}
+		if !h.canRenameFiles() {
+			return nil, errors.New("the client does not support moving directories in workspace edits")
+		}
+		edit, err = movePackage(ctx, bctx, h.FilePath(from), h.FilePath(to))
+		if err == nil {
+			edit = withDirectoryMove(edit, from, to)
+		}
+
+	default:
+		return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: fmt.Sprintf("unknown command %q", params.Command)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resp lsp.ApplyWorkspaceEditResponse
+	if err := conn.Call(ctx, "workspace/applyEdit", lsp.ApplyWorkspaceEditParams{Label: params.Command, Edit: *edit}, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Applied {
+		return nil, fmt.Errorf("the client did not apply the edit: %s", resp.FailureReason)
+	}
+	return nil, nil
+}
+
+// handleWillRenameFiles rewrites the imports of the packages in the
+// directories being moved. Renamed files stay in their package, so they
+// need no edits.
+func (h *LangHandler) handleWillRenameFiles(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.RenameFilesParams) (*lsp.WorkspaceEdit, error) {
+	bctx := h.BuildContext(ctx)
+	result := &lsp.WorkspaceEdit{Changes: make(map[string][]lsp.TextEdit)}
+	for _, rename := range params.Files {
+		if !isFileURI(rename.OldURI) || !isFileURI(rename.NewURI) {
+			continue
+		}
+		from, to := h.FilePath(rename.OldURI), h.FilePath(rename.NewURI)
+		if !bctx.IsDir(from) {
+			continue
+		}
+		edit, err := movePackage(ctx, bctx, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for uri, edits := range edit.Changes {
+			result.Changes[uri] = append(result.Changes[uri], edits...)
+		}
+	}
+	return result, nil
+}
+
+// canRenameFiles reports whether the client can apply workspace edits that
+// rename files and directories.
+func (h *LangHandler) canRenameFiles() bool {
+	caps := h.init.Capabilities.Workspace.WorkspaceEdit
+	if !caps.DocumentChanges {
+		return false
+	}
+	for _, op := range caps.ResourceOperations {
+		if op == "rename" {
+			return true
+		}
+	}
+	return false
+}
+
+// commandArguments decodes the arguments of a command into args.
+func commandArguments(arguments []json.RawMessage, args ...interface{}) error {
+	if len(arguments) != len(args) {
+		return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: fmt.Sprintf("expected %d arguments, got %d", len(args), len(arguments))}
+	}
+	for i, arg := range arguments {
+		if err := json.Unmarshal(arg, args[i]); err != nil {
+			return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: fmt.Sprintf("argument %d: %s", i, err)}
+		}
+	}
+	return nil
+}
+
+// renamePackage returns the edits renaming the package in the directory
+// filename, or in the directory containing the file filename, to newName.
+// The package clauses of its files, including its external tests, are
+// changed, as are the references to it in every file in GOPATH that imports
+// it without naming the import.
+func renamePackage(ctx context.Context, bctx *build.Context, filename, newName string) (*lsp.WorkspaceEdit, error) {
+	if !token.IsIdentifier(newName) || newName == "_" || strings.HasSuffix(newName, "_test") {
+		return nil, fmt.Errorf("%q is not a valid package name", newName)
+	}
+	dir := filename
+	if !bctx.IsDir(dir) {
+		dir = path.Dir(dir)
+	}
+	bp, err := ContainingPackage(bctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	edit := &lsp.WorkspaceEdit{Changes: make(map[string][]lsp.TextEdit)}
+	if bp.Name == newName {
+		return edit, nil
+	}
+	if bp.Name == "main" || newName == "main" {
+		return nil, errors.New("cannot turn a command into a library or back by renaming its package")
+	}
+
+	// Rewrite the clause in the files excluded by build constraints too,
+	// so that the package still compiles elsewhere. Those may belong to
+	// another package, like generators in package main.
+	fset := token.NewFileSet()
+	for _, name := range packageFiles(bp) {
+		f, err := parseGoFile(bctx, fset, filepath.Join(bp.Dir, name), parser.PackageClauseOnly)
+		if err != nil {
+			return nil, err
+		}
+		switch f.Name.Name {
+		case bp.Name:
+			addEdit(edit, fset, f.Name.Pos(), f.Name.End(), newName)
+		case bp.Name + "_test":
+			addEdit(edit, fset, f.Name.Pos(), f.Name.End(), newName+"_test")
+		}
+	}
+
+	importers, err := importersInGOPATH(ctx, bctx, map[string]bool{bp.ImportPath: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, ibp := range importers {
+		for _, name := range packageFiles(ibp) {
+			filename := filepath.Join(ibp.Dir, name)
+			f, err := parseGoFile(bctx, fset, filename, 0)
+			if f == nil {
+				return nil, err
+			}
+			for _, spec := range f.Imports {
+				if spec.Name != nil || importSpecPath(spec) != bp.ImportPath {
+					continue
+				}
+				if err := checkPackageNameFree(f, newName); err != nil {
+					return nil, fmt.Errorf("cannot rename package %s to %s: %s %s", bp.Name, newName, filename, err)
+				}
+				for _, ident := range packageReferences(f, bp.Name) {
+					addEdit(edit, fset, ident.Pos(), ident.End(), newName)
+				}
+			}
+		}
+	}
+	return edit, nil
+}
+
+// checkPackageNameFree returns an error if a reference to a package
+// imported as name would mean something else in f.
+func checkPackageNameFree(f *ast.File, name string) error {
+	for _, spec := range f.Imports {
+		imported := guessPackageName(importSpecPath(spec))
+		if spec.Name != nil {
+			imported = spec.Name.Name
+		}
+		if imported == name {
+			return fmt.Errorf("already imports a package named %s", name)
+		}
+	}
+	if f.Scope.Lookup(name) != nil {
+		return fmt.Errorf("already declares %s", name)
+	}
+	var err error
+	ast.Inspect(f, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == name && ident.Obj != nil && err == nil {
+			err = fmt.Errorf("declares %s locally, which could shadow the package", name)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// packageReferences returns the identifiers of f referring to the package
+// imported as name. They are found syntactically: the operand of a selector
+// refers to an import if the parser could not resolve it within the file.
+func packageReferences(f *ast.File, name string) []*ast.Ident {
+	var refs []*ast.Ident
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == name && x.Obj == nil {
+				refs = append(refs, x)
+			}
+		}
+		return true
+	})
+	return refs
+}
+
+// movePackage returns the edits moving the package in directory from, and
+// the packages in its subdirectories, to directory to: every import of
+// them in GOPATH is rewritten to the new import path, and so are their
+// canonical import comments. The files themselves are not moved, so the
+// edits apply to their original locations.
+func movePackage(ctx context.Context, bctx *build.Context, from, to string) (*lsp.WorkspaceEdit, error) {
+	oldPath, err := gotype.FilenameToImportPath(from, bctx)
+	if err != nil {
+		return nil, err
+	}
+	// The destination usually does not exist yet, so ask for the
+	// import path of a file in it.
+	newPath, err := gotype.FilenameToImportPath(path.Join(to, "doc.go"), bctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range []string{oldPath, newPath} {
+		if p == "" || path.IsAbs(p) {
+			return nil, fmt.Errorf("cannot move packages outside of GOPATH (%s to %s)", from, to)
+		}
+	}
+	if newPath == oldPath || strings.HasPrefix(newPath, oldPath+"/") {
+		return nil, fmt.Errorf("cannot move %s into itself", oldPath)
+	}
+
+	pkgs, err := workspacePackages(ctx, bctx, from)
+	if err != nil {
+		return nil, err
+	}
+	moved := make(map[string]bool)
+	for _, bp := range pkgs {
+		moved[bp.ImportPath] = true
+	}
+	edit := &lsp.WorkspaceEdit{Changes: make(map[string][]lsp.TextEdit)}
+	if len(moved) == 0 {
+		return edit, nil
+	}
+
+	fset := token.NewFileSet()
+	for _, bp := range pkgs {
+		for _, name := range packageFiles(bp) {
+			f, err := parseGoFile(bctx, fset, filepath.Join(bp.Dir, name), parser.PackageClauseOnly|parser.ParseComments)
+			if f == nil {
+				return nil, err
+			}
+			if start, end, ok := importCommentPath(fset, f); ok {
+				addEdit(edit, fset, start, end, strconv.Quote(newPath+strings.TrimPrefix(bp.ImportPath, oldPath)))
+			}
+		}
+	}
+
+	importers, err := importersInGOPATH(ctx, bctx, moved)
+	if err != nil {
+		return nil, err
+	}
+	for _, ibp := range importers {
+		for _, name := range packageFiles(ibp) {
+			f, err := parseGoFile(bctx, fset, filepath.Join(ibp.Dir, name), parser.ImportsOnly)
+			if f == nil {
+				return nil, err
+			}
+			for _, spec := range f.Imports {
+				if p := importSpecPath(spec); moved[p] {
+					addEdit(edit, fset, spec.Path.Pos(), spec.Path.End(), strconv.Quote(newPath+strings.TrimPrefix(p, oldPath)))
+				}
+			}
+		}
+	}
+	return edit, nil
+}
+
+// importCommentPath returns the extent of the quoted path in the canonical
+// import comment of f, like // import "example.com/x" after the package
+// clause, if it has one.
+func importCommentPath(fset *token.FileSet, f *ast.File) (start, end token.Pos, ok bool) {
+	line := fset.Position(f.Name.End()).Line
+	for _, cg := range f.Comments {
+		c := cg.List[0]
+		if c.Pos() < f.Name.End() || fset.Position(c.Pos()).Line != line {
+			continue
+		}
+		text := strings.TrimPrefix(strings.TrimPrefix(c.Text, "//"), "/*")
+		i := strings.Index(text, "import")
+		if i < 0 || strings.TrimSpace(text[:i]) != "" {
+			return token.NoPos, token.NoPos, false
+		}
+		rest := text[i+len("import"):]
+		j := strings.IndexAny(rest, "\"`")
+		if j < 0 || strings.TrimSpace(rest[:j]) != "" {
+			return token.NoPos, token.NoPos, false
+		}
+		quoted, err := strconv.QuotedPrefix(rest[j:])
+		if err != nil {
+			return token.NoPos, token.NoPos, false
+		}
+		start = c.Pos() + token.Pos(len(c.Text)-len(text)+i+len("import")+j)
+		return start, start + token.Pos(len(quoted)), true
+	}
+	return token.NoPos, token.NoPos, false
+}
+
+// withDirectoryMove returns edit as document changes followed by moving the
+// directory from to to, for clients to apply in one go.
+func withDirectoryMove(edit *lsp.WorkspaceEdit, from, to lsp.DocumentURI) *lsp.WorkspaceEdit {
+	uris := make([]string, 0, len(edit.Changes))
+	for uri := range edit.Changes {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	var changes []lsp.DocumentChange
+	for _, uri := range uris {
+		changes = append(changes, lsp.DocumentChange{TextDocumentEdit: &lsp.TextDocumentEdit{
+			TextDocument: lsp.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: lsp.DocumentURI(uri)},
+			},
+			Edits: edit.Changes[uri],
+		}})
+	}
+	changes = append(changes, lsp.DocumentChange{RenameFile: &lsp.RenameFile{Kind: "rename", OldURI: from, NewURI: to}})
+	return &lsp.WorkspaceEdit{DocumentChanges: changes}
+}
+
+// importersInGOPATH returns the packages in GOROOT and GOPATH that import
+// any of the packages with the given import paths, or whose tests do.
+func importersInGOPATH(ctx context.Context, bctx *build.Context, importPaths map[string]bool) ([]*build.Package, error) {
+	var result []*build.Package
+	seen := make(map[string]bool)
+	buildutil.ForEachPackage(bctx, func(importPath string, err error) {
+		// The same import path may be found in several source
+		// directories; bctx.Import resolves it to the first.
+		if err != nil || ctx.Err() != nil || seen[importPath] {
+			return
+		}
+		seen[importPath] = true
+		bp, err := bctx.Import(importPath, "", 0)
+		if err != nil {
+			return
+		}
+		if importsAny(bp.Imports, importPaths) || importsAny(bp.TestImports, importPaths) || importsAny(bp.XTestImports, importPaths) {
+			result = append(result, bp)
+		}
+	})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ImportPath < result[j].ImportPath
+	})
+	return result, ctx.Err()
+}
+
+// packageFiles returns the names of the Go files of bp, including its tests
+// and the files excluded by build constraints.
+func packageFiles(bp *build.Package) []string {
+	var names []string
+	for _, list := range [][]string{bp.GoFiles, bp.CgoFiles, bp.TestGoFiles, bp.XTestGoFiles, bp.IgnoredGoFiles} {
+		names = append(names, list...)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseGoFile parses the named file, read through bctx, in the given mode.
+// Like parser.ParseFile, it returns a partial syntax tree along with any
+// syntax errors.
+func parseGoFile(bctx *build.Context, fset *token.FileSet, filename string, mode parser.Mode) (*ast.File, error) {
+	rc, err := bctx.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return parser.ParseFile(fset, filename, rc, mode)
+}
+
+// addEdit adds an edit replacing [start, end) with newText to edit.
+func addEdit(edit *lsp.WorkspaceEdit, fset *token.FileSet, start, end token.Pos, newText string) {
+	loc := locationForPos(fset, start, end)
+	uri := string(loc.URI)
+	edit.Changes[uri] = append(edit.Changes[uri], lsp.TextEdit{Range: loc.Range, NewText: newText})
+}
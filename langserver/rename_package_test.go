@@ -0,0 +1,151 @@
+package langserver
+
+import (
+	"context"
+	"go/build"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/buildutil"
+)
+
+func renamePackageFakePkgs() map[string]map[string]string {
+	return map[string]map[string]string{
+		"a": {
+			"a.go":      "package a // import \"a\"\n\nfunc F() {}\n",
+			"a_test.go": "package a\n",
+			"x_test.go": "package a_test\n\nimport \"a\"\n\nvar _ = a.F\n",
+			"tagged.go": "//go:build plan9 && !linux\n\npackage a\n",
+			"y_test.go": "//go:build plan9 && !linux\n\npackage a_test\n",
+			"gen.go":    "//go:build ignore\n\npackage main\n",
+		},
+		"a/sub": {"sub.go": "package sub /* import \"a/sub\" */\n\nimport \"a\"\n\nvar _ = a.F\n"},
+		"b":     {"b.go": "package b\n\nimport (\n\t\"a\"\n\tx \"a/sub\"\n)\n\nvar _ = a.F\n\nvar _ = x.G\n\nfunc g(y int) {}\n"},
+	}
+}
+
+// withSubdirs makes bctx, a buildutil.FakeContext for pkgs, list the
+// subdirectories of a package directory along with its files. The fake
+// lists every package as an entry of /go/src, but no subdirectories
+// elsewhere.
+func withSubdirs(bctx *build.Context, pkgs map[string]map[string]string) {
+	readDir := bctx.ReadDir
+	bctx.ReadDir = func(dir string) ([]os.FileInfo, error) {
+		fis, err := readDir(dir)
+		if err != nil || dir == "/go/src" {
+			return fis, err
+		}
+		for importPath := range pkgs {
+			if path.Dir(path.Join("/go/src", importPath)) == dir {
+				fis = append(fis, dirInfo(path.Base(importPath)))
+			}
+		}
+		return fis, nil
+	}
+}
+
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() os.FileMode  { return os.ModeDir | 0755 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() interface{}   { return nil }
+
+// editedFiles applies edit to the files of pkgs and returns the results by
+// path relative to /go/src.
+func editedFiles(t *testing.T, pkgs map[string]map[string]string, edit *lsp.WorkspaceEdit) map[string]string {
+	files := make(map[string]string)
+	for uri, edits := range edit.Changes {
+		file := strings.TrimPrefix(uri, "file:///go/src/")
+		i := strings.LastIndex(file, "/")
+		files[file] = applyEdits(t, pkgs[file[:i]][file[i+1:]], edits)
+	}
+	return files
+}
+
+func TestRenamePackage(t *testing.T) {
+	pkgs := renamePackageFakePkgs()
+	bctx := buildutil.FakeContext(pkgs)
+	bctx.CgoEnabled = true
+
+	edit, err := renamePackage(context.Background(), bctx, "/go/src/a/a.go", "z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := editedFiles(t, pkgs, edit)
+	want := map[string]string{
+		"a/a.go":       "package z // import \"a\"\n\nfunc F() {}\n",
+		"a/a_test.go":  "package z\n",
+		"a/x_test.go":  "package z_test\n\nimport \"a\"\n\nvar _ = z.F\n",
+		"a/tagged.go":  "//go:build plan9 && !linux\n\npackage z\n",
+		"a/y_test.go":  "//go:build plan9 && !linux\n\npackage z_test\n",
+		"a/sub/sub.go": "package sub /* import \"a/sub\" */\n\nimport \"a\"\n\nvar _ = z.F\n",
+		"b/b.go":       "package b\n\nimport (\n\t\"a\"\n\tx \"a/sub\"\n)\n\nvar _ = z.F\n\nvar _ = x.G\n\nfunc g(y int) {}\n",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d edited files, want %d: %v", len(got), len(want), got)
+	}
+	for file, src := range want {
+		if got[file] != src {
+			t.Errorf("%s: got %q, want %q", file, got[file], src)
+		}
+	}
+
+	tests := []struct{ newName, err string }{
+		{"x", "b.go already imports a package named x"},
+		{"y", "b.go declares y locally"},
+		{"a_test", "not a valid package name"},
+		{"main", "cannot turn a command into a library"},
+	}
+	for _, test := range tests {
+		_, err := renamePackage(context.Background(), bctx, "/go/src/a", test.newName)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("renaming to %s: got error %v, want %q", test.newName, err, test.err)
+		}
+	}
+}
+
+func TestMovePackage(t *testing.T) {
+	pkgs := renamePackageFakePkgs()
+	bctx := buildutil.FakeContext(pkgs)
+	bctx.CgoEnabled = true
+	withSubdirs(bctx, pkgs)
+
+	edit, err := movePackage(context.Background(), bctx, "/go/src/a", "/go/src/c/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := editedFiles(t, pkgs, edit)
+	want := map[string]string{
+		"a/a.go":       "package a // import \"c/d\"\n\nfunc F() {}\n",
+		"a/x_test.go":  "package a_test\n\nimport \"c/d\"\n\nvar _ = a.F\n",
+		"a/sub/sub.go": "package sub /* import \"c/d/sub\" */\n\nimport \"c/d\"\n\nvar _ = a.F\n",
+		"b/b.go":       "package b\n\nimport (\n\t\"c/d\"\n\tx \"c/d/sub\"\n)\n\nvar _ = a.F\n\nvar _ = x.G\n\nfunc g(y int) {}\n",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d edited files, want %d: %v", len(got), len(want), got)
+	}
+	for file, src := range want {
+		if got[file] != src {
+			t.Errorf("%s: got %q, want %q", file, got[file], src)
+		}
+	}
+
+	if _, err := movePackage(context.Background(), bctx, "/go/src/a", "/go/src/a/sub/c"); err == nil || !strings.Contains(err.Error(), "into itself") {
+		t.Errorf("got error %v moving a package into itself", err)
+	}
+
+	moved := withDirectoryMove(edit, "file:///go/src/a", "file:///go/src/c/d")
+	if n := len(moved.DocumentChanges); n != len(want)+1 {
+		t.Fatalf("got %d document changes, want %d", n, len(want)+1)
+	}
+	if last := moved.DocumentChanges[len(moved.DocumentChanges)-1]; last.RenameFile == nil || last.RenameFile.NewURI != "file:///go/src/c/d" {
+		t.Errorf("got last document change %+v, want the directory move", last)
+	}
+}
@@ -0,0 +1,121 @@
+package langserver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/buildutil"
+)
+
+func TestRename(t *testing.T) {
+	const a = `package a
+
+import "b"
+
+type I interface{ M() }
+
+type T struct{ E }
+
+type E struct{ Count int }
+
+func (T) M() {}
+
+func (T) N() {}
+
+var x int
+
+func F() int {
+	y := 1
+	t := T{}
+	_ = t.E.Count
+	_ = b.V
+	return x + y + len("")
+}
+
+type S struct{}
+
+type IS interface{ P(S) }
+`
+	pkgs := map[string]map[string]string{
+		"a": {"a.go": a},
+		"b": {"b.go": "package b\n\nvar V int\n"},
+		"c": {"c.go": "package c\n\nimport \"a\"\n\nvar _ = a.F\n\ntype U struct{}\n\nfunc (U) P(a.S) {}\n\nvar _ a.IS = U{}\n"},
+	}
+	bctx := buildutil.FakeContext(pkgs)
+	bctx.CgoEnabled = true
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	tests := []struct {
+		marker, newName string
+		want            []string // substrings of the edited files
+		err             string
+	}{
+		{marker: "F() int", newName: "G", want: []string{"func G() int", "var _ = a.G"}},
+		{marker: "F() int", newName: "f", err: "referred to from package c"},
+		{marker: "Count", newName: "Total", want: []string{"E struct{ Total int }", "t.E.Total"}},
+		{marker: "E }", newName: "Base", want: []string{"T struct{ Base }", "type Base struct", "t.Base.Count"}},
+		{marker: "b.V", newName: "bb", want: []string{`import bb "b"`, "_ = bb.V"}},
+		{marker: "M() {}", newName: "N", err: "a.T already has a field or method N"},
+		{marker: "M() {}", newName: "Z", err: "a.T would no longer implement a.I"},
+		{marker: "M() }", newName: "Z", err: "a.T would no longer implement a.I"},
+		{marker: "P(S)", newName: "Z", err: "c.U would no longer implement a.IS"},
+		{marker: "x int", newName: "y", err: "would be shadowed by the y declared"},
+		{marker: "y := 1", newName: "len", err: "the reference to len"},
+		{marker: "y := 1", newName: "b", err: "the reference to b at"},
+		{marker: "y := 1", newName: "t", err: "t is already declared"},
+		{marker: "len(", newName: "size", err: "cannot rename builtin len"},
+		{marker: "y := 1", newName: "1y", err: "not a valid identifier"},
+	}
+	for _, test := range tests {
+		edit, err := rename(context.Background(), bctx, "/go/src", pkg, f, positionOf(t, a, test.marker), test.newName)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s to %s: got error %v, want %q", test.marker, test.newName, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s to %s: %v", test.marker, test.newName, err)
+			continue
+		}
+		var edited []string
+		for uri, edits := range edit.Changes {
+			file := strings.TrimPrefix(uri, "file:///go/src/")
+			dir := file[:strings.Index(file, "/")]
+			edited = append(edited, applyEdits(t, pkgs[dir][file[len(dir)+1:]], edits))
+		}
+		all := strings.Join(edited, "\n")
+		for _, want := range test.want {
+			if !strings.Contains(all, want) {
+				t.Errorf("%s to %s: edited files do not contain %q:\n%s", test.marker, test.newName, want, all)
+			}
+		}
+	}
+}
+
+func TestPrepareRename(t *testing.T) {
+	const a = "package a\n\nimport \"b\"\n\nvar x = len(b.S)\n"
+	pkgs := map[string]map[string]string{
+		"a": {"a.go": a},
+		"b": {"b.go": "package b\n\nvar S string\n"},
+	}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	got, err := prepareRename("/go/src", pkg, f, positionOf(t, a, "x ="))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lsp.Range{Start: lsp.Position{Line: 4, Character: 4}, End: lsp.Position{Line: 4, Character: 5}}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+
+	if _, err := prepareRename("/go/src", pkg, f, positionOf(t, a, "len")); err == nil {
+		t.Error("builtin can be renamed")
+	}
+	if _, err := prepareRename("/go/src/a", pkg, f, positionOf(t, a, "S)")); err == nil || !strings.Contains(err.Error(), "outside the workspace") {
+		t.Errorf("got error %v renaming a symbol outside the workspace", err)
+	}
+}
@@ -0,0 +1,138 @@
+package langserver
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/types"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleSignatureHelp(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) (*lsp.SignatureHelp, error) {
+	pkg, f, err := h.typecheck(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return signatureHelp(pkg, f, params.Position)
+}
+
+// signatureHelp describes the function called by the innermost call
+// expression whose parentheses enclose position p in f. A nil SignatureHelp
+// is returned if p is not inside the arguments of a call, or the call is a
+// conversion.
+func signatureHelp(pkg *gotype.Package, f *ast.File, p lsp.Position) (*lsp.SignatureHelp, error) {
+	path, pos, err := pathEnclosingPosition(pkg.Fset, f, p)
+	if err != nil {
+		return nil, err
+	}
+	var call *ast.CallExpr
+	for _, n := range path {
+		if c, ok := n.(*ast.CallExpr); ok && c.Lparen < pos && (!c.Rparen.IsValid() || pos <= c.Rparen) {
+			call = c
+			break
+		}
+		if _, ok := n.(*ast.FuncLit); ok {
+			// Calls outside a function literal are not being typed.
+			break
+		}
+	}
+	if call == nil {
+		return nil, nil
+	}
+	tv, ok := pkg.Info.Types[call.Fun]
+	if !ok || tv.IsType() {
+		return nil, nil
+	}
+	sig, ok := tv.Type.Underlying().(*types.Signature)
+	if !ok {
+		return nil, nil
+	}
+
+	name := types.ExprString(call.Fun)
+	var doc string
+	if ident := identOf(call.Fun); ident != nil {
+		name = ident.Name
+		if obj := pkg.Info.Uses[ident]; obj != nil {
+			doc = docComment(pkg, obj)
+		}
+	}
+
+	qf := qualifier(pkg.Types)
+	info := lsp.SignatureInformation{Documentation: doc}
+	var label bytes.Buffer
+	label.WriteString(name)
+	label.WriteByte('(')
+	for i := 0; i < sig.Params().Len(); i++ {
+		if i > 0 {
+			label.WriteString(", ")
+		}
+		param := paramString(sig, i, qf)
+		label.WriteString(param)
+		info.Parameters = append(info.Parameters, lsp.ParameterInformation{Label: param})
+	}
+	label.WriteByte(')')
+	if results := resultsString(sig, qf); results != "" {
+		label.WriteString(" " + results)
+	}
+	info.Label = label.String()
+
+	active := exprIndex(call.Args, pos)
+	if sig.Variadic() && active >= sig.Params().Len() {
+		active = sig.Params().Len() - 1
+	}
+	return &lsp.SignatureHelp{
+		Signatures:      []lsp.SignatureInformation{info},
+		ActiveParameter: active,
+	}, nil
+}
+
+// paramString formats the i'th parameter of sig, e.g. "x int" or "args
+// ...string".
+func paramString(sig *types.Signature, i int, qf types.Qualifier) string {
+	v := sig.Params().At(i)
+	var typ string
+	if sig.Variadic() && i == sig.Params().Len()-1 {
+		// The variadic parameter is a slice, except in the special case
+		// of append([]byte, string...).
+		elem := v.Type()
+		if s, ok := elem.(*types.Slice); ok {
+			elem = s.Elem()
+		}
+		typ = "..." + types.TypeString(elem, qf)
+	} else {
+		typ = types.TypeString(v.Type(), qf)
+	}
+	if v.Name() == "" || v.Name() == "_" {
+		return typ
+	}
+	return v.Name() + " " + typ
+}
+
+// resultsString formats the results of sig as they would appear in its
+// declaration, e.g. "error" or "(n int, err error)".
+func resultsString(sig *types.Signature, qf types.Qualifier) string {
+	results := sig.Results()
+	switch {
+	case results.Len() == 0:
+		return ""
+	case results.Len() == 1 && results.At(0).Name() == "":
+		return types.TypeString(results.At(0).Type(), qf)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('(')
+	for i := 0; i < results.Len(); i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		v := results.At(i)
+		if v.Name() != "" {
+			buf.WriteString(v.Name() + " ")
+		}
+		buf.WriteString(types.TypeString(v.Type(), qf))
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
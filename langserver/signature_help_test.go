@@ -0,0 +1,69 @@
+package langserver
+
+import "testing"
+
+func TestSignatureHelp(t *testing.T) {
+	const a = `package a
+
+import "b"
+
+// F does things.
+func F(x int, rest ...string) (n int, err error) { return }
+
+type T struct{}
+
+func (T) M(s string) bool { return false }
+
+func g() {
+	F(1, "a", "b")
+	m := T{}.M
+	m("")
+	T{}.M(b.G(1, ))
+	_ = int(0)
+	var buf []byte
+	buf = append(buf, "s"...)
+}
+`
+	pkgs := map[string]map[string]string{
+		"a": {"a.go": a},
+		"b": {"b.go": "package b\n\nfunc G(a, b int) string { return \"\" }\n"},
+	}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+
+	tests := []struct {
+		marker string
+		label  string
+		doc    string
+		active int
+	}{
+		{"1, \"a\"", "F(x int, rest ...string) (n int, err error)", "F does things.", 0},
+		{"\"a\", \"b\")", "F(x int, rest ...string) (n int, err error)", "F does things.", 1},
+		{"\"b\")", "F(x int, rest ...string) (n int, err error)", "F does things.", 1},
+		{"\"\")", "m(s string) bool", "", 0},
+		{"b.G(", "M(s string) bool", "", 0},
+		{" ))", "G(a int, b int) string", "", 1},
+		{"buf, \"s\"", "append([]byte, ...string) []byte", "", 0},
+		{"\"s\"...", "append([]byte, ...string) []byte", "", 1},
+	}
+	for _, test := range tests {
+		p := positionOf(t, a, test.marker)
+		p.Character++ // inside the marker
+		help, err := signatureHelp(pkg, f, p)
+		if err != nil {
+			t.Fatalf("%q: %v", test.marker, err)
+		}
+		if help == nil {
+			t.Errorf("%q: no signature help", test.marker)
+			continue
+		}
+		sig := help.Signatures[0]
+		if sig.Label != test.label || sig.Documentation != test.doc || help.ActiveParameter != test.active {
+			t.Errorf("%q: got (%q, %q, %d), want (%q, %q, %d)", test.marker, sig.Label, sig.Documentation, help.ActiveParameter, test.label, test.doc, test.active)
+		}
+	}
+
+	p := positionOf(t, a, "0)")
+	if help, err := signatureHelp(pkg, f, p); err != nil || help != nil {
+		t.Errorf("conversion: got %+v, %v, want no signature help", help, err)
+	}
+}
@@ -0,0 +1,309 @@
+package langserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// implementActions returns the code actions adding to a type the methods
+// it lacks to implement an interface. At an assertion like
+// var _ I = (*T)(nil) failing to compile, a quick fix implements I, which
+// fixes the diagnostics of the assertion among diags. In the declaration of
+// a type, there is a rewrite for each of the candidateInterfaces the type
+// does not implement yet.
+func implementActions(pkg *gotype.Package, f *ast.File, pos token.Pos, only []lsp.CodeActionKind, diags []lsp.Diagnostic) []lsp.CodeAction {
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	var actions []lsp.CodeAction
+	for _, n := range path {
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			if !wantCodeAction(only, lsp.CAKQuickFix) || n.Type == nil {
+				continue
+			}
+			iface := pkg.Info.TypeOf(n.Type)
+			for _, value := range n.Values {
+				T, ptr := receiverType(pkg.Info.TypeOf(value))
+				if T == nil || T.Obj().Pkg() != pkg.Types {
+					continue
+				}
+				edit, err := implementInterface(pkg, T, ptr, iface)
+				if err != nil {
+					continue
+				}
+				action := lsp.CodeAction{
+					Title:       "Implement " + types.TypeString(iface, fileQualifier(f, pkg.Types, pkg.Info)),
+					Kind:        lsp.CAKQuickFix,
+					IsPreferred: true,
+					Edit:        edit,
+				}
+				r := rangeForNode(pkg.Fset, n)
+				for _, d := range diags {
+					if !positionBefore(d.Range.End, r.Start) && !positionBefore(r.End, d.Range.Start) {
+						action.Diagnostics = append(action.Diagnostics, d)
+					}
+				}
+				actions = append(actions, action)
+			}
+			return actions
+
+		case *ast.TypeSpec:
+			obj := pkg.Info.Defs[n.Name]
+			if obj == nil || !wantCodeAction(only, lsp.CAKRefactorRewrite) {
+				return nil
+			}
+			T, ok := obj.Type().(*types.Named)
+			if !ok {
+				return nil
+			}
+			ptr := pointerReceivers(T)
+			qf := fileQualifier(f, pkg.Types, pkg.Info)
+			for _, iface := range candidateInterfaces(pkg) {
+				edit, err := implementInterface(pkg, T, ptr, iface)
+				if err != nil {
+					continue
+				}
+				actions = append(actions, lsp.CodeAction{
+					Title: "Implement " + types.TypeString(iface, qf),
+					Kind:  lsp.CAKRefactorRewrite,
+					Edit:  edit,
+				})
+			}
+			return actions
+
+		case *ast.FuncDecl, *ast.FuncLit:
+			return nil
+		}
+	}
+	return nil
+}
+
+// positionBefore reports whether p comes before q.
+func positionBefore(p, q lsp.Position) bool {
+	return p.Line < q.Line || (p.Line == q.Line && p.Character < q.Character)
+}
+
+// receiverType returns the defined type of the value of type T, which may
+// be a pointer to it, and whether it is.
+func receiverType(T types.Type) (*types.Named, bool) {
+	if ptr, ok := T.(*types.Pointer); ok {
+		named, _ := ptr.Elem().(*types.Named)
+		return named, true
+	}
+	named, _ := T.(*types.Named)
+	return named, false
+}
+
+// pointerReceivers reports whether the methods added to T should have
+// pointer receivers, which they do unless all its methods have value
+// receivers.
+func pointerReceivers(T *types.Named) bool {
+	for i := 0; i < T.NumMethods(); i++ {
+		if sig, ok := T.Method(i).Type().(*types.Signature); ok && !isPointer(sig.Recv().Type()) {
+			continue
+		}
+		return true
+	}
+	return T.NumMethods() == 0
+}
+
+// candidateInterfaces returns the interfaces a type of pkg is likely meant
+// to implement: the error interface, the interfaces declared in pkg, and
+// those of other packages that pkg refers to, e.g. in an assertion like
+// var _ I = (*T)(nil). Listing every interface of the imported packages
+// instead would offer dozens for packages like io.
+func candidateInterfaces(pkg *gotype.Package) []types.Type {
+	seen := make(map[*types.TypeName]bool)
+	var ifaces []types.Type
+	add := func(T types.Type) {
+		named, ok := T.(*types.Named)
+		if !ok || seen[named.Obj()] {
+			return
+		}
+		if _, ok := named.Underlying().(*types.Interface); !ok {
+			return
+		}
+		seen[named.Obj()] = true
+		ifaces = append(ifaces, named)
+	}
+
+	add(types.Universe.Lookup("error").Type())
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		if obj, ok := scope.Lookup(name).(*types.TypeName); ok && !obj.IsAlias() {
+			add(obj.Type())
+		}
+	}
+	var used []*types.TypeName
+	for _, tv := range pkg.Info.Types {
+		named, ok := tv.Type.(*types.Named)
+		if !ok || !tv.IsType() {
+			continue
+		}
+		// Stubs cannot refer to interfaces declared in functions.
+		if obj := named.Obj(); obj.Pkg() != nil && obj.Pkg() != pkg.Types && obj.Parent() == obj.Pkg().Scope() {
+			used = append(used, obj)
+		}
+	}
+	sort.Slice(used, func(i, j int) bool {
+		if used[i].Pkg() != used[j].Pkg() {
+			return used[i].Pkg().Path() < used[j].Pkg().Path()
+		}
+		return used[i].Name() < used[j].Name()
+	})
+	for _, obj := range used {
+		add(obj.Type())
+	}
+	return ifaces
+}
+
+// implementInterface returns the edit adding to the file declaring T stubs
+// of the methods of iface that T lacks, after the last method of T in the
+// file or after its declaration. The stubs have pointer receivers if ptr is
+// set. Their types are qualified as the file does, importing packages into
+// it as needed.
+func implementInterface(pkg *gotype.Package, T *types.Named, ptr bool, iface types.Type) (*lsp.WorkspaceEdit, error) {
+	it, ok := iface.Underlying().(*types.Interface)
+	if !ok || !it.IsMethodSet() {
+		return nil, fmt.Errorf("%s is not an interface", iface)
+	}
+	if named, ok := iface.(*types.Named); ok && named.TypeParams().Len() > 0 {
+		return nil, fmt.Errorf("%s is generic", iface)
+	}
+	if T.TypeParams().Len() > 0 {
+		return nil, fmt.Errorf("%s is generic", T.Obj().Name())
+	}
+	if _, ok := T.Underlying().(*types.Interface); ok {
+		return nil, fmt.Errorf("%s is an interface", T.Obj().Name())
+	}
+	if T.Obj().Parent() != pkg.Types.Scope() {
+		return nil, fmt.Errorf("%s is declared in a function", T.Obj().Name())
+	}
+	var recv types.Type = T
+	if ptr {
+		recv = types.NewPointer(T)
+	}
+	if types.Implements(recv, it) {
+		return nil, fmt.Errorf("%s already implements %s", recv, iface)
+	}
+
+	// Find the methods to add, checking that T has nothing by their
+	// names already.
+	var methods []*types.Func
+	for i := 0; i < it.NumMethods(); i++ {
+		m := it.Method(i)
+		if !m.Exported() && m.Pkg() != pkg.Types {
+			return nil, fmt.Errorf("%s has unexported methods", iface)
+		}
+		obj, _, _ := types.LookupFieldOrMethod(recv, true, pkg.Types, m.Name())
+		if obj == nil {
+			methods = append(methods, m)
+		} else if !types.Identical(obj.Type(), m.Type()) {
+			return nil, fmt.Errorf("%s already has a %s with another type", T.Obj().Name(), m.Name())
+		}
+	}
+	if len(methods) == 0 {
+		// T has every method, but some with a pointer receiver.
+		return nil, fmt.Errorf("%s implements %s with a pointer receiver", T.Obj().Name(), iface)
+	}
+
+	// Find where to add them.
+	f := pkg.File(T.Obj().Pos())
+	if f == nil {
+		return nil, fmt.Errorf("the declaration of %s is not in this package", T.Obj().Name())
+	}
+	var end token.Pos
+	recvName := ""
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if spec, ok := spec.(*ast.TypeSpec); ok && pkg.Info.Defs[spec.Name] == T.Obj() && decl.End() > end {
+					end = decl.End()
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) == 0 || receiverTypeName(pkg.Info, decl.Recv.List[0].Type) != T.Obj() {
+				continue
+			}
+			if decl.End() > end {
+				end = decl.End()
+			}
+			if names := decl.Recv.List[0].Names; recvName == "" && len(names) > 0 && names[0].Name != "_" {
+				recvName = names[0].Name
+			}
+		}
+	}
+	if !end.IsValid() {
+		return nil, errors.New("the declaration of the type is not in a file of the package")
+	}
+	if recvName == "" {
+		r, _ := utf8.DecodeRuneInString(T.Obj().Name())
+		recvName = string(unicode.ToLower(r))
+	}
+
+	qf, importEdits := importingQualifier(pkg.Fset, f, pkg.Types, pkg.Info)
+	recvType := T.Obj().Name()
+	if ptr {
+		recvType = "*" + recvType
+	}
+	var text bytes.Buffer
+	for _, m := range methods {
+		sig := m.Type().(*types.Signature)
+		fmt.Fprintf(&text, "\n\n// %s implements %s.\nfunc (%s %s) %s", m.Name(), types.TypeString(iface, qf), recvName, recvType, m.Name())
+		types.WriteSignature(&text, stubSignature(sig, recvName), qf)
+		text.WriteString(" {\n\tpanic(\"unimplemented\")\n}")
+	}
+	pos := positionForPos(pkg.Fset, end)
+	edits := append(importEdits(), lsp.TextEdit{Range: lsp.Range{Start: pos, End: pos}, NewText: text.String()})
+	return fileEdit(pathToURI(pkg.Fset.Position(f.Pos()).Filename), edits), nil
+}
+
+// stubSignature returns sig without its receiver, and with the parameters
+// and results named like the receiver renamed to _.
+func stubSignature(sig *types.Signature, recvName string) *types.Signature {
+	rename := func(tuple *types.Tuple) *types.Tuple {
+		vars := make([]*types.Var, tuple.Len())
+		for i := range vars {
+			v := tuple.At(i)
+			name := v.Name()
+			if name == recvName {
+				name = "_"
+			}
+			vars[i] = types.NewParam(v.Pos(), v.Pkg(), name, v.Type())
+		}
+		return types.NewTuple(vars...)
+	}
+	return types.NewSignatureType(nil, nil, nil, rename(sig.Params()), rename(sig.Results()), sig.Variadic())
+}
+
+// receiverTypeName returns the type name of a method receiver of type
+// expr, or nil.
+func receiverTypeName(info *types.Info, expr ast.Expr) types.Object {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return info.Uses[e]
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package langserver
+
+import (
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+)
+
+func TestImplementActions(t *testing.T) {
+	const a = `package a
+
+import b2 "b"
+
+type T struct{}
+
+func (t *T) Get(key string) ([]byte, error) { return nil, nil }
+
+type V struct{}
+
+var _ b2.Store = (*T)(nil)
+var _ b2.Store = V{}
+var _ error = W{}
+`
+	const w = `package a
+
+type W struct{}
+
+func (w W) String() string { return "" }
+`
+	pkgs := map[string]map[string]string{
+		"a":  {"a.go": a, "w.go": w},
+		"b":  {"b.go": "package b\n\nimport \"io\"\n\ntype Store interface {\n\tGet(key string) ([]byte, error)\n\tPut(key string, r io.Reader) error\n}\n\ntype Closer interface{ Close() error }\n"},
+		"io": {"io.go": "package io\n\ntype Reader interface{ Read(p []byte) (n int, err error) }\n"},
+	}
+	pkg, f := typecheckFake(t, pkgs, "/go/src/a/a.go")
+	var diags []lsp.Diagnostic
+	for _, err := range pkg.Errs {
+		if _, ok := err.(types.Error); ok {
+			_, d, _ := errorDiagnostic(err)
+			diags = append(diags, *d)
+		}
+	}
+
+	tests := []struct {
+		at    string
+		title string
+		kind  lsp.CodeActionKind
+		uri   string
+		want  []string // fragments of the edited file
+	}{
+		{
+			at:    "(*T)(nil)",
+			title: "Implement b2.Store",
+			kind:  lsp.CAKQuickFix,
+			uri:   "file:///go/src/a/a.go",
+			want: []string{
+				"import b2 \"b\"\nimport \"io\"\n",
+				"{ return nil, nil }\n\n// Put implements b2.Store.\nfunc (t *T) Put(key string, r io.Reader) error {\n\tpanic(\"unimplemented\")\n}\n\ntype V",
+			},
+		},
+		{
+			at:    "V{}",
+			title: "Implement b2.Store",
+			kind:  lsp.CAKQuickFix,
+			uri:   "file:///go/src/a/a.go",
+			want:  []string{"type V struct{}\n\n// Get implements b2.Store.\nfunc (v V) Get(key string) ([]byte, error) {\n\tpanic(\"unimplemented\")\n}\n\n// Put implements b2.Store.\nfunc (v V) Put("},
+		},
+		{
+			at:    "W{}",
+			title: "Implement error",
+			kind:  lsp.CAKQuickFix,
+			uri:   "file:///go/src/a/w.go",
+			want:  []string{"return \"\" }\n\n// Error implements error.\nfunc (w W) Error() string {\n\tpanic(\"unimplemented\")\n}"},
+		},
+		{
+			at:    "T struct",
+			title: "Implement error",
+			kind:  lsp.CAKRefactorRewrite,
+			uri:   "file:///go/src/a/a.go",
+			want:  []string{"{ return nil, nil }\n\n// Error implements error.\nfunc (t *T) Error() string {\n"},
+		},
+		{
+			at:    "T struct",
+			title: "Implement b2.Store",
+			kind:  lsp.CAKRefactorRewrite,
+			uri:   "file:///go/src/a/a.go",
+			want:  []string{"func (t *T) Put(key string, r io.Reader) error {\n"},
+		},
+	}
+
+	// Only the interfaces the package refers to are offered, not every
+	// interface of the packages it imports.
+	pos, err := posForPosition(pkg.Fset.File(f.Pos()), positionOf(t, a, "T struct"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, action := range implementActions(pkg, f, pos, nil, diags) {
+		titles = append(titles, action.Title)
+	}
+	if want := []string{"Implement error", "Implement b2.Store"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("at \"T struct\": got actions %q, want %q", titles, want)
+	}
+
+	for _, test := range tests {
+		pos, err := posForPosition(pkg.Fset.File(f.Pos()), positionOf(t, a, test.at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var action *lsp.CodeAction
+		actions := implementActions(pkg, f, pos, nil, diags)
+		for i := range actions {
+			if actions[i].Title == test.title {
+				action = &actions[i]
+			}
+		}
+		if action == nil {
+			t.Errorf("at %q: no %q action", test.at, test.title)
+			continue
+		}
+		if action.Kind != test.kind {
+			t.Errorf("at %q: got kind %q, want %q", test.at, action.Kind, test.kind)
+		}
+		if test.kind == lsp.CAKQuickFix && len(action.Diagnostics) == 0 {
+			t.Errorf("at %q: the quick fix fixes no diagnostics", test.at)
+		}
+		src := a
+		if strings.HasSuffix(test.uri, "w.go") {
+			src = w
+		}
+		got := applyEdits(t, src, action.Edit.Changes[test.uri])
+		for _, want := range test.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("at %q: %s: edited source does not contain %q:\n%s", test.at, test.title, want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package langserver
+
+import (
+	"context"
+	"go/ast"
+	"go/types"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleTypeDefinition(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) ([]lsp.Location, error) {
+	pkg, f, err := h.typecheck(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return typeDefinition(pkg, f, params.Position)
+}
+
+// typeDefinition returns the locations of the declarations of the named
+// types making up the type of the object at position p in f. Pointers,
+// slices, arrays and channels are unwrapped to their element type, maps to
+// both their key and value types, and functions to their result types.
+// Predeclared types have no location and are omitted.
+func typeDefinition(pkg *gotype.Package, f *ast.File, p lsp.Position) ([]lsp.Location, error) {
+	_, obj, err := objectAtPosition(pkg, f, p)
+	if err != nil {
+		return nil, err
+	}
+	locs := []lsp.Location{}
+	if obj == nil {
+		return locs, nil
+	}
+	if _, ok := obj.(*types.PkgName); ok {
+		return locs, nil
+	}
+	seen := make(map[lsp.Location]bool)
+	for _, named := range namedComponents(obj.Type(), nil) {
+		if loc, ok := objectLocation(pkg, named.Obj()); ok && !seen[loc] {
+			seen[loc] = true
+			locs = append(locs, loc)
+		}
+	}
+	return locs, nil
+}
+
+// namedComponents appends to result the named types T is built from.
+func namedComponents(T types.Type, result []*types.Named) []*types.Named {
+	switch T := T.(type) {
+	case *types.Named:
+		return append(result, T)
+	case *types.Pointer:
+		return namedComponents(T.Elem(), result)
+	case *types.Slice:
+		return namedComponents(T.Elem(), result)
+	case *types.Array:
+		return namedComponents(T.Elem(), result)
+	case *types.Chan:
+		return namedComponents(T.Elem(), result)
+	case *types.Map:
+		return namedComponents(T.Elem(), namedComponents(T.Key(), result))
+	case *types.Signature:
+		for i := 0; i < T.Results().Len(); i++ {
+			result = namedComponents(T.Results().At(i).Type(), result)
+		}
+	}
+	return result
+}
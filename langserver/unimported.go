@@ -0,0 +1,267 @@
+package langserver
+
+import (
+	"context"
+	"go/ast"
+	"go/build"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"golang.org/x/tools/go/buildutil"
+)
+
+// maxUnimportedPackages is the number of packages whose members are offered
+// when completing a selector on a package that is not imported.
+const maxUnimportedPackages = 3
+
+// packageIndex finds the packages in GOROOT and GOPATH by name, so that
+// completion can offer the members of packages that are not imported yet.
+// The list of packages is built on first use and the directories of
+// changed files are looked at again on the next use; the members of a
+// package are read when they are first asked for.
+type packageIndex struct {
+	mu      sync.Mutex
+	byName  map[string][]string      // guessed package name -> import paths; nil until built
+	pending map[string]bool          // directories changed since byName was built
+	members map[string]*packageDecls // by import path
+}
+
+// packageDecls are the exported package-level declarations of a package.
+type packageDecls struct {
+	importPath string
+	name       string // the package's actual name
+	dir        string
+	syms       []indexedSymbol
+}
+
+func newPackageIndex() *packageIndex {
+	return &packageIndex{
+		pending: make(map[string]bool),
+		members: make(map[string]*packageDecls),
+	}
+}
+
+// invalidate forgets the members of the package containing filename, and
+// whether there is a package there at all.
+func (x *packageIndex) invalidate(filename string) {
+	dir := path.Dir(filename)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.pending[dir] = true
+	for importPath, decls := range x.members {
+		if decls.dir == dir {
+			delete(x.members, importPath)
+		}
+	}
+}
+
+// lookup returns the declarations of the packages named name that fromPath
+// may import, most likely candidates first. If ctx is done before the list
+// of packages is built, there are none.
+func (x *packageIndex) lookup(ctx context.Context, bctx *build.Context, fromPath, name string) []*packageDecls {
+	x.mu.Lock()
+	built := x.byName != nil
+	x.mu.Unlock()
+	if !built {
+		// Walking GOROOT and GOPATH takes a while, so it is done
+		// without holding x.mu.
+		byName, err := packagesByName(ctx, bctx)
+		if err != nil {
+			return nil
+		}
+		x.mu.Lock()
+		if x.byName == nil {
+			x.byName = byName
+		}
+		x.mu.Unlock()
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for dir := range x.pending {
+		x.refresh(bctx, dir)
+		delete(x.pending, dir)
+	}
+	var paths []string
+	for _, importPath := range x.byName[name] {
+		if canImport(fromPath, importPath) {
+			paths = append(paths, importPath)
+		}
+	}
+	// Prefer the standard library, then shorter paths.
+	sort.Slice(paths, func(i, j int) bool {
+		a, b := paths[i], paths[j]
+		if sa, sb := isStandardImportPath(a), isStandardImportPath(b); sa != sb {
+			return sa
+		}
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+
+	var result []*packageDecls
+	for _, importPath := range paths {
+		decls := x.members[importPath]
+		if decls == nil {
+			decls = readPackageDecls(bctx, importPath)
+			if decls == nil {
+				continue
+			}
+			x.members[importPath] = decls
+		}
+		if decls.name != name {
+			continue
+		}
+		result = append(result, decls)
+		if len(result) == maxUnimportedPackages {
+			break
+		}
+	}
+	return result
+}
+
+// refresh updates byName for the directory dir, which may have been
+// created or deleted. x.mu must be held.
+func (x *packageIndex) refresh(bctx *build.Context, dir string) {
+	for _, src := range bctx.SrcDirs() {
+		if !PathHasPrefix(dir, src) || dir == src {
+			continue
+		}
+		importPath := PathTrimPrefix(dir, src)
+		guess := guessPackageName(importPath)
+		paths := x.byName[guess][:0]
+		for _, p := range x.byName[guess] {
+			if p != importPath {
+				paths = append(paths, p)
+			}
+		}
+		if bctx.IsDir(dir) {
+			paths = append(paths, importPath)
+		}
+		x.byName[guess] = paths
+		return
+	}
+}
+
+// packagesByName returns the import paths of the packages in GOROOT and
+// GOPATH by their guessed names. It stops with ctx.Err() once ctx is done.
+func packagesByName(ctx context.Context, bctx *build.Context) (map[string][]string, error) {
+	ctxt := *bctx
+	ctxt.ReadDir = func(dir string) ([]os.FileInfo, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return buildutil.ReadDir(bctx, dir)
+	}
+	byName := make(map[string][]string)
+	buildutil.ForEachPackage(&ctxt, func(importPath string, err error) {
+		if err == nil {
+			guess := guessPackageName(importPath)
+			byName[guess] = append(byName[guess], importPath)
+		}
+	})
+	return byName, ctx.Err()
+}
+
+// canImport reports whether the package fromPath may import importPath.
+// Vendored packages and commands are never suggested.
+func canImport(fromPath, importPath string) bool {
+	if importPath == fromPath || strings.HasPrefix(importPath, "cmd/") {
+		return false
+	}
+	elems := strings.Split(importPath, "/")
+	for i, elem := range elems {
+		switch elem {
+		case "vendor":
+			return false
+		case "internal":
+			parent := strings.Join(elems[:i], "/")
+			if parent == "" && !isStandardImportPath(fromPath) {
+				return false
+			}
+			if parent != "" && fromPath != parent && !strings.HasPrefix(fromPath, parent+"/") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// readPackageDecls reads the exported package-level declarations of the
+// package with the given import path, or returns nil if it has no Go
+// files.
+func readPackageDecls(bctx *build.Context, importPath string) *packageDecls {
+	bp, err := bctx.Import(importPath, "", 0)
+	if err != nil {
+		return nil
+	}
+	decls := &packageDecls{importPath: importPath, name: bp.Name, dir: bp.Dir}
+	for _, name := range bp.GoFiles {
+		for _, sym := range indexFile(bctx, filepath.Join(bp.Dir, name), importPath) {
+			if sym.container == "" && ast.IsExported(sym.name) {
+				decls.syms = append(decls.syms, sym)
+			}
+		}
+	}
+	return decls
+}
+
+// unimportedCandidates adds the members of packages named by the operand of
+// sel, which must refer to no object in scope. Each candidate comes with an
+// edit importing its package.
+func (c *completer) unimportedCandidates(sel *ast.SelectorExpr) {
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok || c.opts.packages == nil || c.opts.bctx == nil {
+		return
+	}
+	if c.pkg.Info.Uses[ident] != nil {
+		return
+	}
+	if _, obj := c.scope().LookupParent(ident.Name, c.pos); obj != nil {
+		return
+	}
+
+	fromPath := strings.TrimSuffix(c.pkg.Types.Path(), "_test")
+	for i, decls := range c.opts.packages.lookup(c.opts.ctx, c.opts.bctx, fromPath, ident.Name) {
+		importPath := decls.importPath
+		edit := addImportEdit(c.pkg.Fset, c.f, importName(importPath, decls.name), importPath)
+		for _, sym := range decls.syms {
+			score, ok := fuzzyScore(c.prefix, sym.name)
+			if !ok {
+				continue
+			}
+			item := c.item(sym.name, symbolCompletionKind(sym.kind), "")
+			item.Detail = `"` + importPath + `"`
+			item.AdditionalTextEdits = []lsp.TextEdit{edit}
+			item.Data = &completionData{Package: importPath, Name: sym.name, Unimported: true}
+			// Candidates from different packages share a label.
+			c.candidates = append(c.candidates, candidate{item: item, score: score - i})
+		}
+	}
+}
+
+// symbolCompletionKind returns the completion item kind for a symbol of the
+// given kind.
+func symbolCompletionKind(kind lsp.SymbolKind) lsp.CompletionItemKind {
+	switch kind {
+	case lsp.SKFunction:
+		return lsp.CIKFunction
+	case lsp.SKMethod:
+		return lsp.CIKMethod
+	case lsp.SKInterface:
+		return lsp.CIKInterface
+	case lsp.SKClass:
+		return lsp.CIKClass
+	case lsp.SKConstant:
+		return lsp.CIKConstant
+	case lsp.SKField:
+		return lsp.CIKField
+	}
+	return lsp.CIKVariable
+}
@@ -0,0 +1,155 @@
+package langserver
+
+import (
+	"bytes"
+	"context"
+	"go/build"
+	"io/ioutil"
+	"log"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+)
+
+// workspacePackages returns every package in the directory tree rooted at
+// root. Like the go tool, it skips vendor and testdata directories as well as
+// directories whose names begin with "." or "_".
+func workspacePackages(ctx context.Context, bctx *build.Context, root string) ([]*build.Package, error) {
+	var pkgs []*build.Package
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bp, err := bctx.ImportDir(dir, 0)
+		if err == nil {
+			pkgs = append(pkgs, bp)
+		} else if _, ok := err.(*build.NoGoError); !ok {
+			log.Printf("Skipping package in %s: %s", dir, err)
+		}
+
+		fis, err := bctx.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, fi := range fis {
+			name := fi.Name()
+			if !fi.IsDir() || skipDir(name) {
+				continue
+			}
+			if err := walk(path.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// importers returns the packages in pkgs that import the package with the
+// given import path, directly or through other packages in pkgs. The package
+// itself is included if it is in pkgs. Packages that only import it from
+// their tests are included too.
+func importers(pkgs []*build.Package, importPath string) []*build.Package {
+	deps := map[string]bool{importPath: true}
+	for changed := true; changed; {
+		changed = false
+		for _, bp := range pkgs {
+			if !deps[bp.ImportPath] && importsAny(bp.Imports, deps) {
+				deps[bp.ImportPath] = true
+				changed = true
+			}
+		}
+	}
+
+	var result []*build.Package
+	for _, bp := range pkgs {
+		if deps[bp.ImportPath] || importsAny(bp.TestImports, deps) || importsAny(bp.XTestImports, deps) {
+			result = append(result, bp)
+		}
+	}
+	return result
+}
+
+func importsAny(imports []string, set map[string]bool) bool {
+	for _, imp := range imports {
+		if set[imp] {
+			return true
+		}
+	}
+	return false
+}
+
+// mentions reports whether any of the named files in dir contains word. It is
+// a cheap filter used to avoid type-checking packages that cannot possibly
+// refer to an identifier.
+func mentions(bctx *build.Context, dir string, files []string, word string) bool {
+	for _, name := range files {
+		rc, err := bctx.OpenFile(filepath.Join(dir, name))
+		if err != nil {
+			// Let the type checker report the problem.
+			return true
+		}
+		src, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || bytes.Contains(src, []byte(word)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPackages type-checks pkgs along with their tests and calls fn with
+// each type-checked package. External test packages are checked on their
+// own. If filter is non-nil, sets of files it rejects are not checked.
+// Packages are checked in parallel, so fn must be safe for concurrent use.
+func checkPackages(ctx context.Context, bctx *build.Context, pkgs []*build.Package, filter func(dir string, files []string) bool, fn func(*gotype.Package)) {
+	type unit struct {
+		importPath, dir string
+		files           []string
+	}
+	var units []unit
+	for _, bp := range pkgs {
+		files := append(append([]string{}, bp.GoFiles...), bp.TestGoFiles...)
+		if len(files) > 0 {
+			units = append(units, unit{bp.ImportPath, bp.Dir, files})
+		}
+		if len(bp.XTestGoFiles) > 0 {
+			units = append(units, unit{bp.ImportPath + "_test", bp.Dir, bp.XTestGoFiles})
+		}
+	}
+
+	// Use at most half the CPU cores, but at least always one.
+	n := runtime.NumCPU() / 2
+	if n <= 0 {
+		n = 1
+	}
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for _, u := range units {
+		if filter != nil && !filter(u.dir, u.files) {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(u unit) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if ctx.Err() != nil {
+				return
+			}
+			if pkg := gotype.CheckFiles(ctx, bctx, u.importPath, u.dir, u.files); pkg.Types != nil {
+				fn(pkg)
+			}
+		}(u)
+	}
+	wg.Wait()
+}
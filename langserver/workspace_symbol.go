@@ -0,0 +1,567 @@
+package langserver
+
+import (
+	"context"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"log"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/adamfaulkner/go-langserver/pkg/lspext"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// defaultSymbolLimit is the number of workspace symbols returned when the
+// client does not ask for a specific number.
+const defaultSymbolLimit = 100
+
+func (h *LangHandler) handleWorkspaceSymbol(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lspext.WorkspaceSymbolParams) ([]lsp.SymbolInformation, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultSymbolLimit
+	}
+	// Clients cancel queries as the user types, so the index is built
+	// with a context of its own, and a cancelled query only stops
+	// waiting for it.
+	bctx := h.BuildContext(context.Background())
+	if len(params.Symbol) > 0 {
+		return h.symbols.lookup(ctx, bctx, h.RootFSPath, params.Symbol, limit)
+	}
+	return h.symbols.query(ctx, bctx, h.RootFSPath, params.Query, limit)
+}
+
+// symbolIndex indexes the declarations of every package under the workspace
+// root so that workspace/symbol queries do not have to re-parse the
+// workspace on each keystroke. It is built in the background on the first
+// query; after that only files reported as changed are re-parsed.
+type symbolIndex struct {
+	mu      sync.Mutex
+	ready   chan struct{} // closed when the build started by a query ends
+	built   bool
+	err     error                      // of the last build
+	files   map[string][]indexedSymbol // by absolute filename
+	pending map[string]bool            // files changed since they were indexed
+}
+
+// indexedSymbol is a declaration in the symbolIndex.
+type indexedSymbol struct {
+	name       string
+	container  string // receiver or enclosing type name, if any
+	kind       lsp.SymbolKind
+	pkgName    string
+	importPath string
+	filename   string
+	rng        lsp.Range // of the symbol's name
+}
+
+func newSymbolIndex() *symbolIndex {
+	return &symbolIndex{
+		files:   make(map[string][]indexedSymbol),
+		pending: make(map[string]bool),
+	}
+}
+
+// invalidate marks filename as needing to be re-indexed before the next
+// query.
+func (x *symbolIndex) invalidate(filename string) {
+	x.mu.Lock()
+	x.pending[filename] = true
+	x.mu.Unlock()
+}
+
+// query returns at most limit symbols matching query, best matches first.
+func (x *symbolIndex) query(ctx context.Context, bctx *build.Context, root, query string, limit int) ([]lsp.SymbolInformation, error) {
+	q := parseSymbolQuery(query)
+	type result struct {
+		sym   *indexedSymbol
+		score int
+	}
+	var results []result
+	err := x.forEach(ctx, bctx, root, func(sym *indexedSymbol) {
+		if score, ok := q.score(sym); ok {
+			results = append(results, result{sym, score})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if len(a.sym.name) != len(b.sym.name) {
+			return len(a.sym.name) < len(b.sym.name)
+		}
+		if a.sym.name != b.sym.name {
+			return a.sym.name < b.sym.name
+		}
+		if a.sym.filename != b.sym.filename {
+			return a.sym.filename < b.sym.filename
+		}
+		return a.sym.rng.Start.Line < b.sym.rng.Start.Line
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	syms := make([]lsp.SymbolInformation, len(results))
+	for i, r := range results {
+		syms[i] = r.sym.symbolInformation()
+	}
+	return syms, nil
+}
+
+// lookup returns at most limit symbols whose descriptors contain desc, in
+// file order. See symbolDescriptor for the properties a descriptor has. If
+// desc names a package, that package is searched wherever it is, e.g. in
+// GOROOT; otherwise the packages under root are.
+func (x *symbolIndex) lookup(ctx context.Context, bctx *build.Context, root string, desc lspext.SymbolDescriptor, limit int) ([]lsp.SymbolInformation, error) {
+	var matches []*indexedSymbol
+	match := func(sym *indexedSymbol) {
+		if name, ok := desc["name"].(string); ok && name != sym.name {
+			return
+		}
+		if sym.descriptor().Contains(desc) {
+			matches = append(matches, sym)
+		}
+	}
+	if bp := descriptorPackage(bctx, root, desc); bp != nil {
+		for _, files := range [][]string{bp.GoFiles, bp.TestGoFiles, bp.XTestGoFiles} {
+			for _, name := range files {
+				syms := indexFile(bctx, filepath.Join(bp.Dir, name), bp.ImportPath)
+				for i := range syms {
+					match(&syms[i])
+				}
+			}
+		}
+	} else if err := x.forEach(ctx, bctx, root, match); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.filename != b.filename {
+			return a.filename < b.filename
+		}
+		return a.rng.Start.Line < b.rng.Start.Line
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	syms := make([]lsp.SymbolInformation, len(matches))
+	for i, sym := range matches {
+		syms[i] = sym.symbolInformation()
+	}
+	return syms, nil
+}
+
+// descriptorPackage returns the package named by the "package" property of
+// desc, as imported from root, or nil. The property of an external test
+// package is the import path of the package under test with "_test"
+// appended.
+func descriptorPackage(bctx *build.Context, root string, desc lspext.SymbolDescriptor) *build.Package {
+	importPath, ok := desc["package"].(string)
+	if !ok {
+		return nil
+	}
+	bp, err := bctx.Import(importPath, root, 0)
+	if err != nil && strings.HasSuffix(importPath, "_test") {
+		bp, err = bctx.Import(strings.TrimSuffix(importPath, "_test"), root, 0)
+	}
+	if err != nil {
+		return nil
+	}
+	return bp
+}
+
+// descriptor returns the same descriptor as symbolDescriptor would for the
+// type-checked object, derived from the syntax alone.
+func (s *indexedSymbol) descriptor() lspext.SymbolDescriptor {
+	importPath := s.importPath
+	if strings.HasSuffix(s.pkgName, "_test") && !strings.HasSuffix(importPath, "_test") {
+		// A file of the external test package.
+		importPath += "_test"
+	}
+	importPath, vendor := unvendoredPath(importPath)
+	var kind string
+	switch s.kind {
+	case lsp.SKClass, lsp.SKInterface:
+		kind = "type"
+	case lsp.SKFunction:
+		kind = "func"
+	case lsp.SKMethod:
+		kind = "method"
+	case lsp.SKField:
+		kind = "field"
+	case lsp.SKVariable:
+		kind = "var"
+	case lsp.SKConstant:
+		kind = "const"
+	}
+	return lspext.SymbolDescriptor{
+		"package":     importPath,
+		"packageName": s.pkgName,
+		"name":        s.name,
+		"recv":        s.container,
+		"kind":        kind,
+		"vendor":      vendor,
+	}
+}
+
+func (s *indexedSymbol) symbolInformation() lsp.SymbolInformation {
+	container := s.container
+	if container == "" {
+		container = s.importPath
+	}
+	return lsp.SymbolInformation{
+		Name:          s.name,
+		Kind:          s.kind,
+		Location:      lsp.Location{URI: pathToURI(s.filename), Range: s.rng},
+		ContainerName: container,
+	}
+}
+
+// forEach brings the index up to date and calls fn with every symbol in it.
+// If ctx is done while the index is first built, forEach returns without
+// waiting for the build, which goes on for the next query.
+func (x *symbolIndex) forEach(ctx context.Context, bctx *build.Context, root string, fn func(*indexedSymbol)) error {
+	x.mu.Lock()
+	if !x.built && x.ready == nil {
+		ready := make(chan struct{})
+		x.ready = ready
+		go func() {
+			files, err := buildSymbolIndex(bctx, root)
+			x.mu.Lock()
+			if err == nil {
+				x.files = files
+				x.built = true
+			}
+			x.err = err
+			x.ready = nil
+			x.mu.Unlock()
+			close(ready)
+		}()
+	}
+	ready := x.ready
+	x.mu.Unlock()
+	if ready != nil {
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.built {
+		// The build failed; the next query retries it.
+		return x.err
+	}
+	for filename := range x.pending {
+		x.reindex(bctx, root, filename)
+		delete(x.pending, filename)
+	}
+
+	for _, syms := range x.files {
+		for i := range syms {
+			fn(&syms[i])
+		}
+	}
+	return nil
+}
+
+// buildSymbolIndex returns the symbols of every file of every package under
+// root, by filename.
+func buildSymbolIndex(bctx *build.Context, root string) (map[string][]indexedSymbol, error) {
+	pkgs, err := workspacePackages(context.Background(), bctx, root)
+	if err != nil {
+		return nil, err
+	}
+	type job struct {
+		bp       *build.Package
+		filename string
+	}
+	jobs := make(chan job)
+	go func() {
+		defer close(jobs)
+		for _, bp := range pkgs {
+			for _, files := range [][]string{bp.GoFiles, bp.TestGoFiles, bp.XTestGoFiles} {
+				for _, name := range files {
+					jobs <- job{bp, filepath.Join(bp.Dir, name)}
+				}
+			}
+		}
+	}()
+
+	var (
+		mu    sync.Mutex
+		files = make(map[string][]indexedSymbol)
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				syms := indexFile(bctx, j.filename, j.bp.ImportPath)
+				mu.Lock()
+				files[j.filename] = syms
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return files, nil
+}
+
+// reindex updates the symbols of filename, which may have been created,
+// changed or deleted. x.mu must be held.
+func (x *symbolIndex) reindex(bctx *build.Context, root, filename string) {
+	delete(x.files, filename)
+	if !strings.HasSuffix(filename, ".go") || !PathHasPrefix(filename, root) {
+		return
+	}
+	for _, dir := range strings.Split(PathTrimPrefix(path.Dir(filename), root), "/") {
+		if skipDir(dir) {
+			return
+		}
+	}
+	bp, err := ContainingPackage(bctx, filename)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); !ok {
+			log.Printf("Not indexing %s: %s", filename, err)
+		}
+		return
+	}
+	base := path.Base(filename)
+	if contains(bp.GoFiles, base) || contains(bp.TestGoFiles, base) || contains(bp.XTestGoFiles, base) {
+		x.files[filename] = indexFile(bctx, filename, bp.ImportPath)
+	}
+}
+
+// indexFile returns the symbols declared in filename. Files with syntax
+// errors are indexed as far as they could be parsed.
+func indexFile(bctx *build.Context, filename, importPath string) []indexedSymbol {
+	rc, err := bctx.OpenFile(filename)
+	if err != nil {
+		log.Printf("Not indexing %s: %s", filename, err)
+		return nil
+	}
+	defer rc.Close()
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, filename, rc, 0)
+	if f == nil {
+		return nil
+	}
+
+	var syms []indexedSymbol
+	add := func(name *ast.Ident, container string, kind lsp.SymbolKind) {
+		if name == nil || name.Name == "_" {
+			return
+		}
+		syms = append(syms, indexedSymbol{
+			name:       name.Name,
+			container:  container,
+			kind:       kind,
+			pkgName:    f.Name.Name,
+			importPath: importPath,
+			filename:   filename,
+			rng:        rangeForNode(fset, name),
+		})
+	}
+	addFields := func(fields *ast.FieldList, container string, kind lsp.SymbolKind) {
+		if fields == nil {
+			return
+		}
+		for _, field := range fields.List {
+			for _, name := range field.Names {
+				add(name, container, kind)
+			}
+		}
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				add(decl.Name, receiverBaseName(decl.Recv.List[0].Type), lsp.SKMethod)
+			} else {
+				add(decl.Name, "", lsp.SKFunction)
+			}
+
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					switch t := spec.Type.(type) {
+					case *ast.StructType:
+						add(spec.Name, "", lsp.SKClass)
+						addFields(t.Fields, spec.Name.Name, lsp.SKField)
+					case *ast.InterfaceType:
+						add(spec.Name, "", lsp.SKInterface)
+						addFields(t.Methods, spec.Name.Name, lsp.SKMethod)
+					default:
+						add(spec.Name, "", lsp.SKClass)
+					}
+				case *ast.ValueSpec:
+					kind := lsp.SKVariable
+					if decl.Tok == token.CONST {
+						kind = lsp.SKConstant
+					}
+					for _, name := range spec.Names {
+						add(name, "", kind)
+					}
+				}
+			}
+		}
+	}
+	return syms
+}
+
+// symbolQuery is a parsed workspace/symbol query. A query of the form
+// "x.Name" matches symbols named like Name whose package or container
+// (receiver or enclosing type) starts with x, or whose import path is x.
+type symbolQuery struct {
+	qualifier string
+	name      string
+}
+
+func parseSymbolQuery(query string) symbolQuery {
+	query = strings.TrimSpace(query)
+	if i := strings.LastIndex(query, "."); i >= 0 {
+		return symbolQuery{qualifier: query[:i], name: query[i+1:]}
+	}
+	return symbolQuery{name: query}
+}
+
+// score reports whether sym matches q and how well; higher is better.
+func (q symbolQuery) score(sym *indexedSymbol) (int, bool) {
+	score, ok := fuzzyScore(q.name, sym.name)
+	if !ok || q.qualifier == "" {
+		return score, ok
+	}
+
+	best, matched := 0, false
+	if strings.Contains(q.qualifier, "/") {
+		// An import path, such as "net/http".
+		if sym.importPath == q.qualifier || strings.HasSuffix(sym.importPath, "/"+q.qualifier) {
+			best, matched = fuzzyExact, true
+		}
+	}
+	for _, candidate := range []string{sym.pkgName, sym.container} {
+		if candidate == "" {
+			continue
+		}
+		// Qualifiers must match at least a prefix; anything looser
+		// matches too many unrelated packages.
+		if s, ok := fuzzyScore(q.qualifier, candidate); ok && s >= fuzzyPrefix-maxPenalty && (!matched || s > best) {
+			best, matched = s, true
+		}
+	}
+	if !matched {
+		return 0, false
+	}
+	return score + best/2, true
+}
+
+// Scores assigned by fuzzyScore, from best to worst kind of match.
+const (
+	fuzzyExact           = 1000
+	fuzzyExactIgnoreCase = 900
+	fuzzyPrefix          = 800
+	fuzzySubstring       = 600
+	fuzzySubsequence     = 400
+)
+
+// fuzzyScore reports whether the characters of pattern appear in order in
+// candidate, ignoring case, and scores the match: exact matches beat
+// prefixes, which beat substrings, which beat scattered subsequences.
+// Subsequences that start at word boundaries (e.g. "hc" in "HandlerCommon")
+// score better than others. An empty pattern matches everything.
+func fuzzyScore(pattern, candidate string) (int, bool) {
+	if pattern == "" {
+		return 0, true
+	}
+	if pattern == candidate {
+		return fuzzyExact, true
+	}
+	lp, lc := strings.ToLower(pattern), strings.ToLower(candidate)
+	switch {
+	case lp == lc:
+		return fuzzyExactIgnoreCase, true
+	case strings.HasPrefix(lc, lp):
+		return fuzzyPrefix - penalty(len(lc)-len(lp)), true
+	}
+	if i := strings.Index(lc, lp); i >= 0 {
+		return fuzzySubstring - penalty(i), true
+	}
+
+	score := fuzzySubsequence
+	pi := 0
+	for ci := 0; ci < len(lc) && pi < len(lp); ci++ {
+		if lc[ci] != lp[pi] {
+			score--
+			continue
+		}
+		if isWordStart(candidate, ci) {
+			score += 10
+		}
+		pi++
+	}
+	if pi < len(lp) {
+		return 0, false
+	}
+	if score > fuzzySubstring-maxPenalty {
+		// Never rank a subsequence above a substring.
+		score = fuzzySubstring - maxPenalty - 1
+	}
+	return score, true
+}
+
+// maxPenalty bounds how much a match's score is lowered for unmatched
+// characters, so that kinds of match never overlap.
+const maxPenalty = 100
+
+func penalty(n int) int {
+	if n > maxPenalty {
+		return maxPenalty
+	}
+	return n
+}
+
+// isWordStart reports whether s[i] begins a word in an identifier, as in
+// "HandlerCommon" or "handler_common".
+func isWordStart(s string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev, cur := rune(s[i-1]), rune(s[i])
+	return prev == '_' || (unicode.IsLower(prev) && unicode.IsUpper(cur))
+}
+
+// skipDir reports whether the go tool ignores directories named name when
+// matching packages.
+func skipDir(name string) bool {
+	return name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
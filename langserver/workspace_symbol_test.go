@@ -0,0 +1,172 @@
+package langserver
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adamfaulkner/go-langserver/pkg/lspext"
+	"golang.org/x/tools/go/buildutil"
+)
+
+func TestSymbolIndexQuery(t *testing.T) {
+	pkgs := map[string]map[string]string{
+		"net/http": {"client.go": `package http
+
+type Client struct{ Timeout int }
+
+func (c *Client) Do() {}
+
+func NewRequest() {}
+`},
+		"myhttp": {"h.go": `package myhttp
+
+type HandlerCommon struct{}
+
+func (h *HandlerCommon) Do() {}
+
+var clientCount int
+`},
+	}
+	bctx := buildutil.FakeContext(pkgs)
+	x := newSymbolIndex()
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		{"Client", 100, []string{"net/http.Client", "myhttp.clientCount"}},
+		{"hc", 100, []string{"myhttp.HandlerCommon"}},
+		{"http.Client", 100, []string{"net/http.Client"}},
+		{"net/http.Do", 100, []string{"Client.Do"}},
+		{"Client.Do", 100, []string{"Client.Do"}},
+		{"HandlerCommon.Do", 100, []string{"HandlerCommon.Do"}},
+		{"Do", 1, []string{"HandlerCommon.Do"}},
+		{"NoSuchSymbol", 100, nil},
+	}
+	for _, test := range tests {
+		syms, err := x.query(context.Background(), bctx, "/go/src", test.query, test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, sym := range syms {
+			got = append(got, sym.ContainerName+"."+sym.Name)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	ordered := []string{"foo", "Foo", "FooBar", "BarFoo", "FancyObjectOwner", "fxoxo"}
+	prev := 1 << 30
+	for _, candidate := range ordered {
+		score, ok := fuzzyScore("foo", candidate)
+		if !ok {
+			t.Fatalf("%q does not match", candidate)
+		}
+		if score >= prev {
+			t.Errorf("%q scored %d, want less than %d", candidate, score, prev)
+		}
+		prev = score
+	}
+	if _, ok := fuzzyScore("foo", "of"); ok {
+		t.Error("\"of\" should not match \"foo\"")
+	}
+}
+
+func TestSymbolIndexLookup(t *testing.T) {
+	pkgs := map[string]map[string]string{
+		"net/http": {"client.go": `package http
+
+type Client struct{ Timeout int }
+
+func (c *Client) Do() {}
+
+type Doer interface{ Do() }
+`},
+		"myhttp": {"h.go": "package myhttp\n\ntype Client struct{}\n"},
+	}
+	bctx := buildutil.FakeContext(pkgs)
+	x := newSymbolIndex()
+
+	tests := []struct {
+		desc lspext.SymbolDescriptor
+		want []string
+	}{
+		{lspext.SymbolDescriptor{"package": "net/http", "name": "Client", "recv": ""}, []string{"net/http.Client"}},
+		{lspext.SymbolDescriptor{"name": "Client", "kind": "type"}, []string{"myhttp.Client", "net/http.Client"}},
+		{lspext.SymbolDescriptor{"name": "Do"}, []string{"Client.Do", "Doer.Do"}},
+		{lspext.SymbolDescriptor{"recv": "Client", "kind": "field"}, []string{"Client.Timeout"}},
+		{lspext.SymbolDescriptor{"package": "net/http", "name": "Client", "vendor": true}, nil},
+	}
+	for _, test := range tests {
+		syms, err := x.lookup(context.Background(), bctx, "/go/src", test.desc, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, sym := range syms {
+			got = append(got, sym.ContainerName+"."+sym.Name)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %q, want %q", test.desc, got, test.want)
+		}
+	}
+
+	// Packages outside the workspace are found by their import path.
+	syms, err := x.lookup(context.Background(), bctx, "/go/src/myhttp", lspext.SymbolDescriptor{"package": "net/http", "name": "Client"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(syms) != 1 || syms[0].Location.URI != "file:///go/src/net/http/client.go" {
+		t.Errorf("got %v outside the workspace, want net/http.Client", syms)
+	}
+}
+
+func TestSymbolIndexCancel(t *testing.T) {
+	pkgs := map[string]map[string]string{
+		"a": {"a.go": "package a\n\nfunc F() {}\n"},
+	}
+	bctx := buildutil.FakeContext(pkgs)
+	readDir := bctx.ReadDir
+	unblock := make(chan struct{})
+	var walks int32 // reads of the workspace root
+	bctx.ReadDir = func(dir string) ([]os.FileInfo, error) {
+		if dir == "/go/src" {
+			atomic.AddInt32(&walks, 1)
+			<-unblock
+		}
+		return readDir(dir)
+	}
+	x := newSymbolIndex()
+
+	// A query cancelled while the index is built returns at once.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := x.query(ctx, bctx, "/go/src", "F", 100); err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	// The build goes on for the next query rather than starting over.
+	close(unblock)
+	syms, err := x.query(context.Background(), bctx, "/go/src", "F", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(syms) != 1 || syms[0].Name != "F" {
+		t.Errorf("got %v, want F", syms)
+	}
+	n := atomic.LoadInt32(&walks)
+	if _, err := newSymbolIndex().query(context.Background(), bctx, "/go/src", "F", 100); err != nil {
+		t.Fatal(err)
+	}
+	if perBuild := atomic.LoadInt32(&walks) - n; n != perBuild {
+		t.Errorf("the workspace root was read %d times, want %d as for one build", n, perBuild)
+	}
+}
@@ -0,0 +1,154 @@
+package langserver
+
+import (
+	"context"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/adamfaulkner/go-langserver/pkg/lspext"
+	"github.com/sourcegraph/jsonrpc2"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+func (h *LangHandler) handleXDefinition(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) ([]lspext.SymbolLocationInformation, error) {
+	pkg, f, err := h.typecheck(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return xdefinition(pkg, f, params.Position)
+}
+
+// xdefinition is like definition, but also describes the symbol that is
+// defined with a SymbolDescriptor. Builtin objects have a descriptor but no
+// location.
+func xdefinition(pkg *gotype.Package, f *ast.File, p lsp.Position) ([]lspext.SymbolLocationInformation, error) {
+	node, obj, err := objectAtPosition(pkg, f, p)
+	if err != nil {
+		return nil, err
+	}
+	if ident, ok := node.(*ast.Ident); ok {
+		if use := pkg.Info.Uses[ident]; use != nil {
+			obj = use
+		}
+	}
+	if obj == nil {
+		return []lspext.SymbolLocationInformation{}, nil
+	}
+	loc, _ := objectLocation(pkg, obj)
+	return []lspext.SymbolLocationInformation{{
+		Location: loc,
+		Symbol:   symbolDescriptor(pkg, obj),
+	}}, nil
+}
+
+// symbolDescriptor describes obj in a way that does not depend on where the
+// code is checked out, so that symbols can be correlated across
+// repositories. Its keys are:
+//
+//	package     import path, with any vendor directory prefix removed
+//	packageName package name
+//	name        object name
+//	recv        receiver type of a method, or the type containing a field
+//	            or interface method; "" otherwise
+//	kind        one of package, type, func, method, field, var, const or label
+//	vendor      whether the package is vendored
+func symbolDescriptor(pkg *gotype.Package, obj types.Object) lspext.SymbolDescriptor {
+	declPkg := declaringPackage(obj)
+	pkgPath, pkgName := "builtin", "builtin"
+	if declPkg != nil {
+		pkgPath, pkgName = declPkg.Path(), declPkg.Name()
+	}
+	pkgPath, vendor := unvendoredPath(pkgPath)
+	return lspext.SymbolDescriptor{
+		"package":     pkgPath,
+		"packageName": pkgName,
+		"name":        obj.Name(),
+		"recv":        recvName(pkg, obj),
+		"kind":        objectKind(obj),
+		"vendor":      vendor,
+	}
+}
+
+// unvendoredPath strips the vendor directory prefix from importPath,
+// reporting whether there was one.
+func unvendoredPath(importPath string) (string, bool) {
+	if strings.HasPrefix(importPath, "vendor/") {
+		return strings.TrimPrefix(importPath, "vendor/"), true
+	}
+	if i := strings.LastIndex(importPath, "/vendor/"); i >= 0 {
+		return importPath[i+len("/vendor/"):], true
+	}
+	return importPath, false
+}
+
+// objectKind returns the descriptor kind of obj.
+func objectKind(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.PkgName:
+		return "package"
+	case *types.TypeName:
+		return "type"
+	case *types.Func:
+		if obj.Type().(*types.Signature).Recv() != nil {
+			return "method"
+		}
+		return "func"
+	case *types.Var:
+		if obj.IsField() {
+			return "field"
+		}
+		return "var"
+	case *types.Const:
+		return "const"
+	case *types.Builtin:
+		return "func"
+	case *types.Label:
+		return "label"
+	}
+	return "nil"
+}
+
+// recvName returns the name of the type obj is a method or field of, or ""
+// if it is neither.
+func recvName(pkg *gotype.Package, obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Func:
+		recv := obj.Type().(*types.Signature).Recv()
+		if recv == nil {
+			return ""
+		}
+		t := recv.Type()
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		if named, ok := t.(*types.Named); ok {
+			return named.Obj().Name()
+		}
+	case *types.Var:
+		if !obj.IsField() {
+			return ""
+		}
+	default:
+		return ""
+	}
+
+	// Fields (and methods of unnamed interfaces) do not know which type
+	// they belong to, so find the enclosing type declaration.
+	f := pkg.File(obj.Pos())
+	if f == nil {
+		return ""
+	}
+	path, _ := astutil.PathEnclosingInterval(f, obj.Pos(), obj.Pos())
+	for _, n := range path {
+		switch n := n.(type) {
+		case *ast.TypeSpec:
+			return n.Name.Name
+		case *ast.FuncDecl, *ast.FuncLit:
+			return ""
+		}
+	}
+	return ""
+}
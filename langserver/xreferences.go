@@ -0,0 +1,156 @@
+package langserver
+
+import (
+	"context"
+	"go/build"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/adamfaulkner/go-langserver/gotype"
+	"github.com/adamfaulkner/go-langserver/pkg/lsp"
+	"github.com/adamfaulkner/go-langserver/pkg/lspext"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleWorkspaceReferences(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lspext.WorkspaceReferencesParams) ([]lspext.ReferenceInformation, error) {
+	var emit func(lspext.ReferenceInformation)
+	if h.init.Capabilities.Streaming {
+		stream := newPartialResultStreamer(ctx, conn, req.ID)
+		emit = func(ref lspext.ReferenceInformation) { stream(ref) }
+	}
+	return workspaceReferences(ctx, h.checkBuildContext(ctx), h.RootFSPath, params, emit)
+}
+
+// workspaceReferences returns the references in the packages under root to
+// the symbols matching params.Query, as described by symbolDescriptor. Only
+// package-level symbols, methods and fields are considered.
+//
+// The "dirs" hint restricts the search to the listed directories, given as
+// file URIs or paths relative to root. If emit is non-nil it is called with
+// each reference as soon as it is found.
+func workspaceReferences(ctx context.Context, bctx *build.Context, root string, params lspext.WorkspaceReferencesParams, emit func(lspext.ReferenceInformation)) ([]lspext.ReferenceInformation, error) {
+	pkgs, err := workspacePackages(ctx, bctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if dirs, ok := params.Hints["dirs"].([]interface{}); ok {
+		pkgs = packagesInDirs(pkgs, root, dirs)
+	}
+	if path, ok := params.Query["package"].(string); ok {
+		pkgs = importers(pkgs, path)
+	}
+	name, _ := params.Query["name"].(string)
+
+	// The packages are checked concurrently, so all references are
+	// collected and sorted before the limit applies. The references are
+	// streamed as they are found only if there is no limit.
+	streaming := emit != nil && params.Limit <= 0
+	var (
+		mu   sync.Mutex
+		refs = []lspext.ReferenceInformation{}
+	)
+	checkPackages(ctx, bctx, pkgs, func(dir string, files []string) bool {
+		return name == "" || mentions(bctx, dir, files, name)
+	}, func(pkg *gotype.Package) {
+		found := findSymbolReferences(pkg, params.Query)
+		mu.Lock()
+		defer mu.Unlock()
+		refs = append(refs, found...)
+		if streaming {
+			for _, ref := range found {
+				emit(ref)
+			}
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return locationLess(refs[i].Reference, refs[j].Reference)
+	})
+	if params.Limit > 0 && len(refs) > params.Limit {
+		refs = refs[:params.Limit]
+	}
+	if emit != nil && !streaming {
+		for _, ref := range refs {
+			emit(ref)
+		}
+	}
+	return refs, nil
+}
+
+// findSymbolReferences returns the references in pkg to non-local objects
+// whose descriptors contain query.
+func findSymbolReferences(pkg *gotype.Package, query lspext.SymbolDescriptor) []lspext.ReferenceInformation {
+	name, _ := query["name"].(string)
+	var refs []lspext.ReferenceInformation
+	for ident, obj := range pkg.Info.Uses {
+		if name != "" && obj.Name() != name {
+			continue
+		}
+		if obj.Pkg() == nil || isLocal(obj) {
+			continue
+		}
+		desc := symbolDescriptor(pkg, obj)
+		if !desc.Contains(query) {
+			continue
+		}
+		refs = append(refs, lspext.ReferenceInformation{
+			Reference: locationForNode(pkg.Fset, ident),
+			Symbol:    desc,
+		})
+	}
+	return refs
+}
+
+// packagesInDirs returns the packages in pkgs whose directory is one of
+// dirs. Each dir is a file URI or a path relative to root.
+func packagesInDirs(pkgs []*build.Package, root string, dirs []interface{}) []*build.Package {
+	want := make(map[string]bool)
+	for _, dir := range dirs {
+		s, ok := dir.(string)
+		if !ok {
+			continue
+		}
+		if isFileURI(lsp.DocumentURI(s)) {
+			s = uriToFilePath(lsp.DocumentURI(s))
+		} else if !filepath.IsAbs(s) {
+			s = filepath.Join(root, s)
+		}
+		want[filepath.Clean(s)] = true
+	}
+	var result []*build.Package
+	for _, bp := range pkgs {
+		if want[filepath.Clean(bp.Dir)] {
+			result = append(result, bp)
+		}
+	}
+	return result
+}
+
+// newPartialResultStreamer returns a function that sends each result it is
+// called with to the client as a "$/partialResult" notification for the
+// request with the given ID. The results form a JSON array, which the first
+// notification initializes.
+func newPartialResultStreamer(ctx context.Context, conn jsonrpc2.JSONRPC2, id jsonrpc2.ID) func(interface{}) {
+	lspID := lsp.ID{Num: id.Num, Str: id.Str, IsString: id.IsString}
+	first := true
+	return func(result interface{}) {
+		patch := []interface{}{}
+		if first {
+			patch = append(patch, jsonPatchOp{Op: "replace", Path: "", Value: []interface{}{}})
+			first = false
+		}
+		patch = append(patch, jsonPatchOp{Op: "add", Path: "/-", Value: result})
+		_ = conn.Notify(ctx, "$/partialResult", &lspext.PartialResultParams{ID: lspID, Patch: patch})
+	}
+}
+
+// jsonPatchOp is a single JSON Patch operation, as described at
+// http://jsonpatch.com/.
+type jsonPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
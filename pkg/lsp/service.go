@@ -30,6 +30,9 @@ func (p *InitializeParams) Root() DocumentURI {
 type DocumentURI string
 
 type ClientCapabilities struct {
+	Workspace    WorkspaceClientCapabilities    `json:"workspace,omitempty"`
+	TextDocument TextDocumentClientCapabilities `json:"textDocument,omitempty"`
+
 	// Below are Sourcegraph extensions. They do not live in lspext since
 	// they are extending the field InitializeParams.Capabilities
 
@@ -44,6 +47,67 @@ type ClientCapabilities struct {
 	// XCacheProvider indicates the client provides support for cache/get
 	// and cache/set.
 	XCacheProvider bool `json:"xcacheProvider,omitempty"`
+
+	// Streaming indicates the client accepts results as a stream of
+	// "$/partialResult" notifications, each carrying a JSON Patch to the
+	// result, before the final response.
+	Streaming bool `json:"streaming,omitempty"`
+}
+
+type WorkspaceClientCapabilities struct {
+	WorkspaceEdit WorkspaceEditClientCapabilities `json:"workspaceEdit,omitempty"`
+}
+
+type WorkspaceEditClientCapabilities struct {
+	// DocumentChanges indicates the client supports the documentChanges
+	// field of WorkspaceEdit.
+	DocumentChanges bool `json:"documentChanges,omitempty"`
+
+	// ResourceOperations lists the file operations, such as "rename",
+	// the client supports in documentChanges.
+	ResourceOperations []string `json:"resourceOperations,omitempty"`
+}
+
+type TextDocumentClientCapabilities struct {
+	CodeAction     CodeActionClientCapabilities     `json:"codeAction,omitempty"`
+	Completion     CompletionClientCapabilities     `json:"completion,omitempty"`
+	DocumentSymbol DocumentSymbolClientCapabilities `json:"documentSymbol,omitempty"`
+	Rename         RenameClientCapabilities         `json:"rename,omitempty"`
+}
+
+type CodeActionClientCapabilities struct {
+	// CodeActionLiteralSupport indicates the client accepts CodeAction
+	// literals, rather than only Commands, in response to
+	// textDocument/codeAction.
+	CodeActionLiteralSupport *CodeActionLiteralSupport `json:"codeActionLiteralSupport,omitempty"`
+}
+
+type CodeActionLiteralSupport struct {
+	CodeActionKind struct {
+		ValueSet []CodeActionKind `json:"valueSet"`
+	} `json:"codeActionKind"`
+}
+
+type CompletionClientCapabilities struct {
+	CompletionItem CompletionItemClientCapabilities `json:"completionItem,omitempty"`
+}
+
+type CompletionItemClientCapabilities struct {
+	// SnippetSupport indicates the client accepts completion items whose
+	// insert text is a snippet with tab stops and placeholders.
+	SnippetSupport bool `json:"snippetSupport,omitempty"`
+}
+
+type RenameClientCapabilities struct {
+	// PrepareSupport indicates the client sends textDocument/prepareRename
+	// before renaming.
+	PrepareSupport bool `json:"prepareSupport,omitempty"`
+}
+
+type DocumentSymbolClientCapabilities struct {
+	// HierarchicalDocumentSymbolSupport indicates the client accepts a
+	// tree of DocumentSymbol in response to textDocument/documentSymbol.
+	HierarchicalDocumentSymbolSupport bool `json:"hierarchicalDocumentSymbolSupport,omitempty"`
 }
 
 type InitializeResult struct {
@@ -117,6 +181,112 @@ func (v *TextDocumentSyncOptionsOrKind) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+type RenameOptions struct {
+	PrepareProvider bool `json:"prepareProvider,omitempty"`
+}
+
+// RenameOptionsOrBool holds either a bool or RenameOptions. The LSP API
+// allows either to be specified in the (ServerCapabilities).RenameProvider
+// field, but only clients that support textDocument/prepareRename accept
+// RenameOptions.
+type RenameOptionsOrBool struct {
+	Bool    bool
+	Options *RenameOptions
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v RenameOptionsOrBool) MarshalJSON() ([]byte, error) {
+	if v.Options != nil {
+		return json.Marshal(v.Options)
+	}
+	return json.Marshal(v.Bool)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *RenameOptionsOrBool) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*v = RenameOptionsOrBool{}
+		return nil
+	}
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*v = RenameOptionsOrBool{Bool: b}
+		return nil
+	}
+	var tmp RenameOptions
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	*v = RenameOptionsOrBool{Options: &tmp}
+	return nil
+}
+
+type CodeActionOptions struct {
+	CodeActionKinds []CodeActionKind `json:"codeActionKinds,omitempty"`
+}
+
+// CodeActionOptionsOrBool holds either a bool or CodeActionOptions. The LSP
+// API allows either to be specified in the
+// (ServerCapabilities).CodeActionProvider field, but only clients that
+// support CodeAction literals accept CodeActionOptions.
+type CodeActionOptionsOrBool struct {
+	Bool    bool
+	Options *CodeActionOptions
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v CodeActionOptionsOrBool) MarshalJSON() ([]byte, error) {
+	if v.Options != nil {
+		return json.Marshal(v.Options)
+	}
+	return json.Marshal(v.Bool)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *CodeActionOptionsOrBool) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*v = CodeActionOptionsOrBool{}
+		return nil
+	}
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*v = CodeActionOptionsOrBool{Bool: b}
+		return nil
+	}
+	var tmp CodeActionOptions
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	*v = CodeActionOptionsOrBool{Options: &tmp}
+	return nil
+}
+
+type ExecuteCommandOptions struct {
+	Commands []string `json:"commands"`
+}
+
+type WorkspaceServerCapabilities struct {
+	FileOperations *FileOperationsServerCapabilities `json:"fileOperations,omitempty"`
+}
+
+type FileOperationsServerCapabilities struct {
+	WillRename *FileOperationRegistrationOptions `json:"willRename,omitempty"`
+}
+
+type FileOperationRegistrationOptions struct {
+	Filters []FileOperationFilter `json:"filters"`
+}
+
+type FileOperationFilter struct {
+	Scheme  string               `json:"scheme,omitempty"`
+	Pattern FileOperationPattern `json:"pattern"`
+}
+
+type FileOperationPattern struct {
+	Glob    string `json:"glob"`
+	Matches string `json:"matches,omitempty"` // "file" or "folder"
+}
+
 type SaveOptions struct {
 	IncludeText bool `json:"includeText"`
 }
@@ -127,16 +297,20 @@ type ServerCapabilities struct {
 	CompletionProvider               *CompletionOptions               `json:"completionProvider,omitempty"`
 	SignatureHelpProvider            *SignatureHelpOptions            `json:"signatureHelpProvider,omitempty"`
 	DefinitionProvider               bool                             `json:"definitionProvider,omitempty"`
+	TypeDefinitionProvider           bool                             `json:"typeDefinitionProvider,omitempty"`
+	ImplementationProvider           bool                             `json:"implementationProvider,omitempty"`
 	ReferencesProvider               bool                             `json:"referencesProvider,omitempty"`
 	DocumentHighlightProvider        bool                             `json:"documentHighlightProvider,omitempty"`
 	DocumentSymbolProvider           bool                             `json:"documentSymbolProvider,omitempty"`
 	WorkspaceSymbolProvider          bool                             `json:"workspaceSymbolProvider,omitempty"`
-	CodeActionProvider               bool                             `json:"codeActionProvider,omitempty"`
+	CodeActionProvider               CodeActionOptionsOrBool          `json:"codeActionProvider,omitempty"`
 	CodeLensProvider                 *CodeLensOptions                 `json:"codeLensProvider,omitempty"`
 	DocumentFormattingProvider       bool                             `json:"documentFormattingProvider,omitempty"`
 	DocumentRangeFormattingProvider  bool                             `json:"documentRangeFormattingProvider,omitempty"`
 	DocumentOnTypeFormattingProvider *DocumentOnTypeFormattingOptions `json:"documentOnTypeFormattingProvider,omitempty"`
-	RenameProvider                   bool                             `json:"renameProvider,omitempty"`
+	RenameProvider                   RenameOptionsOrBool              `json:"renameProvider,omitempty"`
+	ExecuteCommandProvider           *ExecuteCommandOptions           `json:"executeCommandProvider,omitempty"`
+	Workspace                        *WorkspaceServerCapabilities     `json:"workspace,omitempty"`
 
 	// XWorkspaceReferencesProvider indicates the server provides support for
 	// xworkspace/references. This is a Sourcegraph extension.
@@ -191,18 +365,36 @@ const (
 	CIKColor                          = 16
 	CIKFile                           = 17
 	CIKReference                      = 18
+	CIKFolder                         = 19
+	CIKEnumMember                     = 20
+	CIKConstant                       = 21
+	CIKStruct                         = 22
+	CIKEvent                          = 23
+	CIKOperator                       = 24
+)
+
+type InsertTextFormat int
+
+const (
+	ITFPlainText InsertTextFormat = 1
+	ITFSnippet                    = 2
 )
 
 type CompletionItem struct {
-	Label         string      `json:"label"`
-	Kind          int         `json:"kind,omitempty"`
-	Detail        string      `json:"detail,omitempty"`
-	Documentation string      `json:"documentation,omitempty"`
-	SortText      string      `json:"sortText,omitempty"`
-	FilterText    string      `json:"filterText,omitempty"`
-	InsertText    string      `json:"insertText,omitempty"`
-	TextEdit      TextEdit    `json:"textEdit,omitempty"`
-	Data          interface{} `json:"data,omitempty"`
+	Label            string           `json:"label"`
+	Kind             int              `json:"kind,omitempty"`
+	Detail           string           `json:"detail,omitempty"`
+	Documentation    string           `json:"documentation,omitempty"`
+	SortText         string           `json:"sortText,omitempty"`
+	FilterText       string           `json:"filterText,omitempty"`
+	InsertText       string           `json:"insertText,omitempty"`
+	InsertTextFormat InsertTextFormat `json:"insertTextFormat,omitempty"`
+	TextEdit         *TextEdit        `json:"textEdit,omitempty"`
+	Data             interface{}      `json:"data,omitempty"`
+
+	// AdditionalTextEdits are applied along with the completion, e.g. to
+	// add an import. They must not overlap the main edit.
+	AdditionalTextEdits []TextEdit `json:"additionalTextEdits,omitempty"`
 }
 
 type CompletionList struct {
@@ -354,6 +546,21 @@ type SymbolInformation struct {
 	ContainerName string     `json:"containerName,omitempty"`
 }
 
+// DocumentSymbol represents a symbol in a document along with the symbols
+// nested in it, such as the fields and methods of a type.
+type DocumentSymbol struct {
+	Name   string     `json:"name"`
+	Detail string     `json:"detail,omitempty"`
+	Kind   SymbolKind `json:"kind"`
+
+	// Range encloses the symbol's whole declaration, while
+	// SelectionRange is just its name.
+	Range          Range `json:"range"`
+	SelectionRange Range `json:"selectionRange"`
+
+	Children []DocumentSymbol `json:"children,omitempty"`
+}
+
 type WorkspaceSymbolParams struct {
 	Query string `json:"query"`
 	Limit int    `json:"limit"`
@@ -361,6 +568,33 @@ type WorkspaceSymbolParams struct {
 
 type CodeActionContext struct {
 	Diagnostics []Diagnostic `json:"diagnostics"`
+
+	// Only, if set, restricts the kinds of code actions the client
+	// wants.
+	Only []CodeActionKind `json:"only,omitempty"`
+}
+
+// CodeActionKind is a hierarchical kind of code action, with dots
+// separating its parts, such as "refactor.extract".
+type CodeActionKind string
+
+const (
+	CAKQuickFix              CodeActionKind = "quickfix"
+	CAKRefactor              CodeActionKind = "refactor"
+	CAKRefactorExtract       CodeActionKind = "refactor.extract"
+	CAKRefactorInline        CodeActionKind = "refactor.inline"
+	CAKRefactorRewrite       CodeActionKind = "refactor.rewrite"
+	CAKSource                CodeActionKind = "source"
+	CAKSourceOrganizeImports CodeActionKind = "source.organizeImports"
+)
+
+type CodeAction struct {
+	Title       string         `json:"title"`
+	Kind        CodeActionKind `json:"kind,omitempty"`
+	Diagnostics []Diagnostic   `json:"diagnostics,omitempty"`
+	IsPreferred bool           `json:"isPreferred,omitempty"`
+	Edit        *WorkspaceEdit `json:"edit,omitempty"`
+	Command     *Command       `json:"command,omitempty"`
 }
 
 type CodeActionParams struct {
@@ -396,6 +630,45 @@ type RenameParams struct {
 	NewName      string                 `json:"newName"`
 }
 
+type ExecuteCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
+type ApplyWorkspaceEditParams struct {
+	Label string        `json:"label,omitempty"`
+	Edit  WorkspaceEdit `json:"edit"`
+}
+
+type ApplyWorkspaceEditResponse struct {
+	Applied       bool   `json:"applied"`
+	FailureReason string `json:"failureReason,omitempty"`
+}
+
+type RenameFilesParams struct {
+	Files []FileRename `json:"files"`
+}
+
+type FileRename struct {
+	OldURI DocumentURI `json:"oldUri"`
+	NewURI DocumentURI `json:"newUri"`
+}
+
+// DocumentChange holds either a TextDocumentEdit or a RenameFile
+// operation, which share the (WorkspaceEdit).DocumentChanges field.
+type DocumentChange struct {
+	TextDocumentEdit *TextDocumentEdit
+	RenameFile       *RenameFile
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v DocumentChange) MarshalJSON() ([]byte, error) {
+	if v.RenameFile != nil {
+		return json.Marshal(v.RenameFile)
+	}
+	return json.Marshal(v.TextDocumentEdit)
+}
+
 type DidOpenTextDocumentParams struct {
 	TextDocument TextDocumentItem `json:"textDocument"`
 }
@@ -415,6 +688,19 @@ type DidCloseTextDocumentParams struct {
 	TextDocument TextDocumentIdentifier `json:"textDocument"`
 }
 
+type WillSaveTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Reason       TextDocumentSaveReason `json:"reason"`
+}
+
+type TextDocumentSaveReason int
+
+const (
+	TDSRManual     TextDocumentSaveReason = 1
+	TDSRAfterDelay TextDocumentSaveReason = 2
+	TDSRFocusOut   TextDocumentSaveReason = 3
+)
+
 type DidSaveTextDocumentParams struct {
 	TextDocument TextDocumentIdentifier `json:"textDocument"`
 }
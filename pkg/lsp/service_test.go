@@ -98,3 +98,73 @@ func TestMarkedString_MarshalUnmarshalJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestRenameOptionsOrBool_MarshalUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want RenameOptionsOrBool
+	}{
+		{
+			data: []byte(`true`),
+			want: RenameOptionsOrBool{Bool: true},
+		},
+		{
+			data: []byte(`{"prepareProvider":true}`),
+			want: RenameOptionsOrBool{Options: &RenameOptions{PrepareProvider: true}},
+		},
+	}
+	for _, test := range tests {
+		var got RenameOptionsOrBool
+		if err := json.Unmarshal(test.data, &got); err != nil {
+			t.Error(err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("got %+v, want %+v", got, test.want)
+			continue
+		}
+		data, err := json.Marshal(got)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !bytes.Equal(data, test.data) {
+			t.Errorf("got JSON %q, want %q", data, test.data)
+		}
+	}
+}
+
+func TestCodeActionOptionsOrBool_MarshalUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want CodeActionOptionsOrBool
+	}{
+		{
+			data: []byte(`true`),
+			want: CodeActionOptionsOrBool{Bool: true},
+		},
+		{
+			data: []byte(`{"codeActionKinds":["quickfix","source.organizeImports"]}`),
+			want: CodeActionOptionsOrBool{Options: &CodeActionOptions{CodeActionKinds: []CodeActionKind{CAKQuickFix, CAKSourceOrganizeImports}}},
+		},
+	}
+	for _, test := range tests {
+		var got CodeActionOptionsOrBool
+		if err := json.Unmarshal(test.data, &got); err != nil {
+			t.Error(err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("got %+v, want %+v", got, test.want)
+			continue
+		}
+		data, err := json.Marshal(got)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !bytes.Equal(data, test.data) {
+			t.Errorf("got JSON %q, want %q", data, test.data)
+		}
+	}
+}
@@ -102,6 +102,41 @@ type WorkspaceEdit struct {
 	 * Holds changes to existing resources.
 	 */
 	Changes map[string][]TextEdit `json:"changes"`
+
+	/**
+	 * Text edits and file operations, applied in order. Clients that
+	 * support them prefer them over changes.
+	 */
+	DocumentChanges []DocumentChange `json:"documentChanges,omitempty"`
+}
+
+type TextDocumentEdit struct {
+	/**
+	 * The text document to change.
+	 */
+	TextDocument OptionalVersionedTextDocumentIdentifier `json:"textDocument"`
+
+	/**
+	 * The edits to be applied.
+	 */
+	Edits []TextEdit `json:"edits"`
+}
+
+type RenameFile struct {
+	/**
+	 * Always "rename".
+	 */
+	Kind string `json:"kind"`
+
+	/**
+	 * The file or folder to rename.
+	 */
+	OldURI DocumentURI `json:"oldUri"`
+
+	/**
+	 * The new location.
+	 */
+	NewURI DocumentURI `json:"newUri"`
 }
 
 type TextDocumentIdentifier struct {
@@ -134,6 +169,15 @@ type TextDocumentItem struct {
 	Text string `json:"text"`
 }
 
+type OptionalVersionedTextDocumentIdentifier struct {
+	TextDocumentIdentifier
+	/**
+	 * The version number of this document, or null if the edit does not
+	 * depend on the version the client has.
+	 */
+	Version *int `json:"version"`
+}
+
 type VersionedTextDocumentIdentifier struct {
 	TextDocumentIdentifier
 	/**
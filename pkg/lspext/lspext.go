@@ -2,6 +2,7 @@ package lspext
 
 import (
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 
@@ -64,7 +65,7 @@ type SymbolLocationInformation struct {
 func (s SymbolDescriptor) Contains(other SymbolDescriptor) bool {
 	for k, v := range other {
 		v2, ok := s[k]
-		if !ok || v != v2 {
+		if !ok || !reflect.DeepEqual(v, v2) {
 			return false
 		}
 	}